@@ -13,9 +13,15 @@ import (
 func FiberConfig() fiber.Config {
 	// Define server settings.
 	readTimeoutSecondsCount, _ := strconv.Atoi(os.Getenv("SERVER_READ_TIMEOUT"))
+	// 作答图片可以直接上传，请求体上限默认 32MB
+	bodyLimit, _ := strconv.Atoi(os.Getenv("SERVER_BODY_LIMIT"))
+	if bodyLimit <= 0 {
+		bodyLimit = 32 << 20
+	}
 
 	// Return Fiber configuration.
 	return fiber.Config{
 		ReadTimeout: time.Second * time.Duration(readTimeoutSecondsCount),
+		BodyLimit:   bodyLimit,
 	}
 }
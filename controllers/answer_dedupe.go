@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"context"
+	"examination-papers/grading"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// answerGradingKey 汇总租户、题目版本、作答内容、判卷智能体与 prompt 的摘要。流水线中写死或取自环境变量的
+// app id（如打分阶段的 HANDLE_SCORE_APPID）由 ContentHash 按实际取值计入，不同租户之间不复用结果。
+// 作答图片未能全部取得摘要或题目缺少内容摘要时返回空串，表示不可复用
+func (sc *SubmitExamCase) answerGradingKey(task ExamStudentAnswerTask, images grading.AnswerImages, itemContentHash string, item map[string]interface{}, profile grading.Profile) string {
+	if itemContentHash == "" || (len(task.Answers) > 0 && len(images.Hashes) == 0) {
+		return ""
+	}
+	pipeline, err := sc.registry.PipelineFor(profile)
+	if err != nil {
+		return ""
+	}
+	inputs := map[string]interface{}{
+		"tenant_id":          task.TenantID,
+		"item":               itemContentHash,
+		"images":             images.Hashes,
+		"answer_text":        task.AnswerText,
+		"app_id":             profile.AppID,
+		"single_call_app_id": profile.SingleCallAppID,
+		"prompt":             profile.Prompt,
+	}
+	for k, v := range item {
+		inputs["item_"+k] = v
+	}
+	return grading.ContentHash(pipeline, inputs)
+}
+
+// reuseGradedBlock 查找判卷输入完全相同且已成功判卷的作答，复制其结果。命中时返回 true。
+// 只复用智能体的判卷结果：需要人工复核或经人工改分的作答不作为来源
+func (sc *SubmitExamCase) reuseGradedBlock(ctx context.Context, task ExamStudentAnswerTask, images grading.AnswerImages, gradingKey string) bool {
+	query := `
+		UPDATE exam_blocks b SET
+			status = s.status,
+			score = s.score,
+			full_score = s.full_score,
+			result = s.result,
+			model_full_score = s.model_full_score,
+			full_score_mismatch = s.full_score_mismatch,
+			graded_answers = $3,
+			grader = s.grader,
+			score_breakdown = s.score_breakdown,
+			grader_output = s.grader_output,
+			confidence = s.confidence,
+			pipeline_mode = s.pipeline_mode,
+			prompt_template_id = s.prompt_template_id,
+			prompt_version = s.prompt_version,
+			image_hashes = $4,
+			grading_key = $5,
+			cache_hit = TRUE,
+			cache_source_block_id = s.block_id,
+			review_status = NULL,
+			review_reasons = NULL,
+			review_claimed_by = NULL,
+			review_claimed_at = NULL
+		FROM (
+			SELECT * FROM exam_blocks
+			WHERE grading_key = $5 AND status = 'true' AND block_id <> $2
+				AND review_status IS NULL AND COALESCE(grader, '') <> 'human'
+			ORDER BY updated_at DESC
+			LIMIT 1
+		) s
+		WHERE b.submit_id = $1 AND b.block_id = $2
+`
+	res, err := sc.db.ExecContext(ctx, query, task.SubmitId, task.BlockID, pq.Array(images.Considered), pq.Array(images.Hashes), gradingKey)
+	if err != nil {
+		log.Printf("[reuseGradedBlock] Update failed for block %s: %v", task.BlockID, err)
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
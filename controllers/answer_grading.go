@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"context"
+	"examination-papers/grading"
+	"examination-papers/utils"
+	"log"
+	"time"
+)
+
+// GRADINGFAILEDTEXT 是判卷失败时写回作答块的结果文本
+const GRADINGFAILEDTEXT = "批卷失败，请检查！"
+
+// agentGrading 是一次智能体判卷的输出
+type agentGrading struct {
+	success    bool
+	pipeline   string                // 实际执行的流水线名称
+	resultText string                // 写回作答块的评语
+	output     *grading.GraderOutput // 结构化分数，打分失败时为 nil
+	run        grading.RunResult     // 各阶段的执行记录
+	err        error                 // 流水线失败原因
+	duration   time.Duration         // 整条流水线耗时
+}
+
+// gradeWithAgents 执行判卷配置对应的流水线。流水线需输出 result（评语）与 grader_output（结构化分数）
+func (sc *SubmitExamCase) gradeWithAgents(ctx context.Context, blockID string, profile grading.Profile, vars map[string]interface{}) agentGrading {
+	pipeline, err := sc.registry.PipelineFor(profile)
+	if err != nil {
+		log.Printf("[gradeWithAgents] No pipeline for block %s: %v", blockID, err)
+		return agentGrading{resultText: GRADINGFAILEDTEXT, err: err}
+	}
+	start := time.Now()
+	run, err := pipeline.Run(ctx, profile, vars, utils.AgentRequestContext)
+	graded := agentGrading{
+		pipeline:   pipeline.Name,
+		resultText: run.Text("result"),
+		output:     run.GraderOutput("grader_output"),
+		run:        run,
+		err:        err,
+		duration:   time.Since(start),
+	}
+	if graded.resultText == "" {
+		graded.resultText = GRADINGFAILEDTEXT
+	}
+	if err != nil {
+		log.Printf("[gradeWithAgents] Pipeline %s failed for block %s: %v", pipeline.Name, blockID, err)
+	}
+	graded.success = err == nil && graded.output != nil
+	return graded
+}
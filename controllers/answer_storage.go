@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"examination-papers/grading"
+	"examination-papers/utils"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ANSWEROBJECTPREFIX = "answers/sha256/"
+
+// answerPresignExpiry 读取 ANSWER_PRESIGN_EXPIRY_MINUTES，默认 60 分钟，需覆盖一次判卷调用的耗时
+func answerPresignExpiry() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("ANSWER_PRESIGN_EXPIRY_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return time.Hour
+}
+
+// answerObjectKey 按图片内容生成对象 key，相同的图片只存一份
+func answerObjectKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return ANSWEROBJECTPREFIX + hex.EncodeToString(sum[:])
+}
+
+// persistAnswerImages 提交时下载全部作答图片（直传的对象直接读取）存入 MinIO，返回每个 block_id 对应的对象 key，
+// 顺序与 AnswerList 一致。源地址过期后判卷和重判仍然可用。未配置 MinIO 时返回 nil
+func (sc *SubmitExamCase) persistAnswerImages(ctx context.Context, tenantID string, answers []StudentAnswer) (map[string][]string, error) {
+	if sc.minioClient == nil {
+		return nil, nil
+	}
+	type job struct {
+		blockID string
+		index   int
+		url     string
+	}
+	objects := make(map[string][]string, len(answers))
+	var jobs []job
+	for _, ans := range answers {
+		objects[ans.BlockID] = make([]string, len(ans.AnswerList))
+		for i, answerURL := range ans.AnswerList {
+			jobs = append(jobs, job{blockID: ans.BlockID, index: i, url: answerURL})
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	sem := make(chan struct{}, 8)
+	for _, j := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(j job) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			key, err := sc.persistAnswerImage(ctx, tenantID, j.url)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("block %s: %w", j.blockID, err)
+				}
+				return
+			}
+			objects[j.blockID][j.index] = key
+		}(j)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return objects, nil
+}
+
+func (sc *SubmitExamCase) persistAnswerImage(ctx context.Context, tenantID, answerURL string) (string, error) {
+	var data []byte
+	var err error
+	if utils.IsUploadObjectKey(answerURL) {
+		data, err = sc.readUploadedObject(ctx, answerURL)
+	} else {
+		data, err = sc.urlPolicy.Fetch(ctx, tenantID, answerURL)
+	}
+	if err != nil {
+		return "", fmt.Errorf("fetch %s: %w", answerURL, err)
+	}
+	key := answerObjectKey(data)
+	if err := sc.minioClient.PutIfAbsent(ctx, key, data, http.DetectContentType(data)); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// answerImageSources 返回交给判卷智能体的图片地址、下载函数及已知的内容摘要。
+// 作答图片已存入 MinIO 时使用预签名地址，并直接从 MinIO 读取，摘要取自对象 key；否则使用原始地址
+func (sc *SubmitExamCase) answerImageSources(ctx context.Context, task ExamStudentAnswerTask) ([]string, grading.FetchFunc, map[string]string, error) {
+	if sc.minioClient == nil || len(task.AnswerObjects) == 0 {
+		return task.Answers, func(ctx context.Context, url string) ([]byte, error) {
+			return sc.urlPolicy.Fetch(ctx, task.TenantID, url)
+		}, nil, nil
+	}
+	urls := make([]string, 0, len(task.AnswerObjects))
+	keys := make(map[string]string, len(task.AnswerObjects))
+	hashes := make(map[string]string, len(task.AnswerObjects))
+	for _, key := range task.AnswerObjects {
+		presigned, err := sc.minioClient.PresignedGet(ctx, key, answerPresignExpiry())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		urls = append(urls, presigned)
+		keys[presigned] = key
+		if strings.HasPrefix(key, ANSWEROBJECTPREFIX) {
+			hashes[presigned] = strings.TrimPrefix(key, ANSWEROBJECTPREFIX)
+		}
+	}
+	return urls, func(ctx context.Context, url string) ([]byte, error) {
+		key, ok := keys[url]
+		if !ok {
+			return nil, fmt.Errorf("unknown answer image %s", url)
+		}
+		return sc.minioClient.Get(ctx, key)
+	}, hashes, nil
+}
+
+// originalAnswerURLs 将参与判卷的预签名地址换回提交时的原始地址，预签名地址会过期，不落库
+func originalAnswerURLs(task ExamStudentAnswerTask, sources, considered []string) []string {
+	if len(task.AnswerObjects) == 0 || len(sources) != len(task.Answers) {
+		return considered
+	}
+	original := make(map[string]string, len(sources))
+	for i, source := range sources {
+		original[source] = task.Answers[i]
+	}
+	urls := make([]string, 0, len(considered))
+	for _, url := range considered {
+		if o, ok := original[url]; ok {
+			url = o
+		}
+		urls = append(urls, url)
+	}
+	return urls
+}
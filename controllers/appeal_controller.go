@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+
+	"examination-papers/grading"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type AppealRequest struct {
+	Reason        string `json:"reason" validate:"required"`      // 申诉理由
+	RequestedBy   string `json:"requested_by"`                    // 申诉人
+	AppID         string `json:"app_id"`                          // 使用其他判卷智能体重判
+	Pipeline      string `json:"pipeline"`                        // 使用其他流水线重判
+	PromptVersion int    `json:"prompt_version" validate:"gte=0"` // 使用指定版本的 prompt 重判
+}
+
+// AppealController 重新打开单个作答块并重新判卷，重判结果以 result_updated 事件推送到原回调地址。
+// 只能申诉 token 所属租户的作答块
+func (sc *SubmitExamCase) AppealController(c *fiber.Ctx) error {
+	var req AppealRequest
+	if failure := bindAndValidate(c, &req); failure != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(failure)
+	}
+	if req.Pipeline != "" {
+		pipeline, err := sc.registry.Pipeline(req.Pipeline)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"code":    1,
+				"message": err.Error(),
+			})
+		}
+		if !pipeline.GradesAnswers() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"code":    1,
+				"message": "Pipeline " + req.Pipeline + " does not produce grader output",
+			})
+		}
+	}
+	if req.AppID != "" && !sc.registry.HasApp(req.AppID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code":    1,
+			"message": "App " + req.AppID + " is not configured",
+		})
+	}
+	blockID := c.Params("block_id")
+
+	tx, err := sc.db.Beginx()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	var status string
+	task := ExamStudentAnswerTask{BlockID: blockID, ForceRegrade: true, AppID: req.AppID, Pipeline: req.Pipeline, PromptVersion: req.PromptVersion}
+	query := `
+		SELECT submit_id, exam_id, item_id, student_id, answer, COALESCE(answer_objects, '{}'), COALESCE(answer_text, ''), callback,
+			COALESCE(tenant_id, ''), status
+		FROM exam_blocks WHERE block_id = $1 AND COALESCE(tenant_id, '') = $2 FOR UPDATE
+`
+	err = tx.QueryRow(query, blockID, requestTenant(c)).Scan(&task.SubmitId, &task.ExamID, &task.ItemID, &task.StudentID, pq.Array(&task.Answers),
+		pq.Array(&task.AnswerObjects), &task.AnswerText, &task.Callback, &task.TenantID, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"code":    1,
+			"message": "Block not found",
+		})
+	}
+	if err != nil {
+		log.Printf("[AppealController] Query error: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if status == "pending" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"code":    1,
+			"message": "Block is still being graded",
+		})
+	}
+	if req.AppID != "" {
+		usesApp, err := sc.appealUsesProfileApp(tx, task.ItemID, req.Pipeline)
+		if err != nil {
+			log.Printf("[AppealController] Query error: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+		}
+		if !usesApp {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"code":    1,
+				"message": "The item's grading pipeline does not use a profile app, app_id cannot be overridden",
+			})
+		}
+	}
+	if req.PromptVersion > 0 {
+		exists, err := sc.promptVersionExists(tx, task.ItemID, req.PromptVersion)
+		if err != nil {
+			log.Printf("[AppealController] Query error: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+		}
+		if !exists {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"code":    1,
+				"message": "Prompt template version " + strconv.Itoa(req.PromptVersion) + " not found for the item's subject",
+			})
+		}
+	}
+
+	insertQuery := `
+		INSERT INTO appeals (block_id, requested_by, reason, app_id, pipeline, prompt_version, previous_score)
+		SELECT block_id, NULLIF($2, ''), $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, 0), score
+		FROM exam_blocks WHERE block_id = $1
+		RETURNING id
+`
+	if err := tx.QueryRow(insertQuery, blockID, req.RequestedBy, req.Reason, req.AppID, req.Pipeline, req.PromptVersion).Scan(&task.AppealID); err != nil {
+		log.Printf("[AppealController] Insert failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed for appeal")
+	}
+	// 早于判卷历史上线的作答块没有历史记录，重开前补记当前结果
+	backfillQuery := attemptSnapshotQuery + ` AND NOT EXISTS (SELECT 1 FROM grading_attempts g WHERE g.block_id = b.block_id)`
+	if _, err := tx.Exec(backfillQuery, blockID, ATTEMPTTRIGGERSUBMIT, 0); err != nil {
+		log.Printf("[AppealController] Backfill attempt failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	// 重新打开作答块，旧结果已保存在 grading_attempts 中
+	reopenQuery := `UPDATE exam_blocks SET status = 'pending', review_status = NULL, review_reasons = NULL WHERE block_id = $1`
+	if _, err := tx.Exec(reopenQuery, blockID); err != nil {
+		log.Printf("[AppealController] Reopen failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	payload, _ := json.Marshal(task)
+	if err := enqueueTx(tx, STUDENTANSWERSQUEUE, []string{string(payload)}); err != nil {
+		log.Printf("[AppealController] Failed to enqueue regrade for block %s: %v", blockID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add task to queue")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Commit failed")
+	}
+	sc.kickOutbox()
+	return c.JSON(fiber.Map{
+		"code":      0,
+		"message":   "Appeal submitted successfully",
+		"appeal_id": task.AppealID,
+	})
+}
+
+// promptVersionExists 判断题目所属学科下是否存在指定版本的 prompt
+func (sc *SubmitExamCase) promptVersionExists(tx *sqlx.Tx, itemID string, version int) (bool, error) {
+	var subject string
+	err := tx.QueryRow(`SELECT COALESCE(subject, '') FROM exam_items WHERE item_id = $1`, itemID).Scan(&subject)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM prompt_templates WHERE subject = $1 AND version = $2)`
+	err = tx.QueryRow(query, grading.NormalizeSubject(subject), version).Scan(&exists)
+	return exists, err
+}
+
+// appealUsesProfileApp 判断重判使用的流水线是否有阶段采用判卷配置中的智能体。
+// 各阶段都写死 app id 的流水线会忽略申诉指定的 app_id
+func (sc *SubmitExamCase) appealUsesProfileApp(tx *sqlx.Tx, itemID, pipelineName string) (bool, error) {
+	var subject, questionType string
+	query := `SELECT COALESCE(subject, ''), COALESCE(question_type, '') FROM exam_items WHERE item_id = $1`
+	err := tx.QueryRow(query, itemID).Scan(&subject, &questionType)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	profile := sc.registry.Resolve(subject, questionType)
+	if pipelineName != "" {
+		profile.Pipeline = pipelineName
+	}
+	pipeline, err := sc.registry.PipelineFor(profile)
+	if err != nil {
+		return false, nil
+	}
+	return pipeline.UsesProfileApp(), nil
+}
+
+// completeAppeal 记录重判后的分数并推送结果
+func (sc *SubmitExamCase) completeAppeal(task ExamStudentAnswerTask) {
+	query := `
+		UPDATE appeals a SET
+			status = CASE WHEN b.status = 'true' THEN 'completed' ELSE 'failed' END,
+			score = b.score
+		FROM exam_blocks b
+		WHERE a.id = $1 AND b.block_id = a.block_id
+`
+	if _, err := sc.db.Exec(query, task.AppealID); err != nil {
+		log.Printf("[completeAppeal] Update failed for appeal %d: %v", task.AppealID, err)
+	}
+	sc.notifyBlockUpdated(task.BlockID)
+}
+
+// ListGradingAttemptsController 返回作答块的全部判卷历史及每次智能体调用，最早的在前。
+// 只能查看 token 所属租户的作答块
+func (sc *SubmitExamCase) ListGradingAttemptsController(c *fiber.Ctx) error {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM exam_blocks WHERE block_id = $1 AND COALESCE(tenant_id, '') = $2)`
+	if err := sc.db.QueryRow(query, c.Params("block_id"), requestTenant(c)).Scan(&exists); err != nil {
+		log.Printf("[ListGradingAttemptsController] Query error: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if !exists {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"code":    1,
+			"message": "Block not found",
+		})
+	}
+	attempts, err := sc.loadGradingAttempts("a.block_id = $1", c.Params("block_id"))
+	if err != nil {
+		log.Printf("[ListGradingAttemptsController] Query error: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"data": attempts,
+	})
+}
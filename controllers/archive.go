@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"examination-papers/grading"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	ARCHIVEPREFIX        = "archives/"
+	ARCHIVEBUNDLEFILE    = "bundle.json"
+	ARCHIVEBUNDLEVERSION = "grading_bundle.v1"
+)
+
+// ArchiveAsset 是判卷包中的一个附件，Key 相对于判卷包目录
+type ArchiveAsset struct {
+	Page        int    `json:"page"`
+	Source      string `json:"source"`
+	Key         string `json:"key,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Error       string `json:"error,omitempty"` // 附件未能归档的原因，例如源地址已过期
+	URL         string `json:"url,omitempty"`   // 读取判卷包时生成的临时下载地址，不写入包内
+}
+
+// archiveItem 是判卷时使用的题目及预处理结果
+type archiveItem struct {
+	Body                string              `json:"body" db:"body"`
+	CorrectAnswer       string              `json:"correct_answer" db:"correct_answer"`
+	BodyResult          *string             `json:"body_result" db:"body_result"`
+	CorrectAnswerResult *string             `json:"correct_answer_result" db:"correct_answer_result"`
+	FullScore           decimal.NullDecimal `json:"full_score" db:"full_score"`
+	Subject             *string             `json:"subject" db:"subject"`
+	QuestionType        *string             `json:"question_type" db:"question_type"`
+	Rubric              grading.Rubric      `json:"rubric" db:"rubric"`
+	ContentHash         *string             `json:"content_hash" db:"content_hash"`
+}
+
+// archiveAnswer 是学生作答
+type archiveAnswer struct {
+	Images        []ArchiveAsset `json:"images"`
+	Text          string         `json:"text"`
+	GradedAnswers []string       `json:"graded_answers"` // 实际参与判卷的图片
+}
+
+// GradingBundle 是一次判卷的完整归档：作答图片、题目预处理结果、prompt、智能体原始输出及最终结果
+type GradingBundle struct {
+	Version    string         `json:"version"`
+	BlockID    string         `json:"block_id"`
+	ExamID     string         `json:"exam_id"`
+	ItemID     string         `json:"item_id"`
+	StudentID  string         `json:"student_id"`
+	SubmitID   string         `json:"submit_id"`
+	ArchivedAt time.Time      `json:"archived_at"`
+	Item       archiveItem    `json:"item"`
+	Answer     archiveAnswer  `json:"answer"`
+	Attempt    GradingAttempt `json:"attempt"`
+}
+
+// GradingArchive 是一条判卷包记录
+type GradingArchive struct {
+	ID        int64      `json:"id" db:"id"`
+	BlockID   string     `json:"block_id" db:"block_id"`
+	AttemptID int64      `json:"attempt_id" db:"attempt_id"`
+	Prefix    string     `json:"prefix" db:"object_prefix"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at" db:"expires_at"`
+	DeletedAt *time.Time `json:"deleted_at" db:"deleted_at"`
+}
+
+// archiveRetention 返回租户判卷包的保留时长，0 表示永久保留。
+//
+//	ARCHIVE_RETENTION_DAYS         默认 365
+//	ARCHIVE_TENANT_RETENTION_DAYS  形如 tenantA=30;tenantB=0，按租户覆盖
+func archiveRetention(tenantID string) time.Duration {
+	days := 365
+	if v, err := strconv.Atoi(os.Getenv("ARCHIVE_RETENTION_DAYS")); err == nil && v >= 0 {
+		days = v
+	}
+	for _, entry := range strings.Split(os.Getenv("ARCHIVE_TENANT_RETENTION_DAYS"), ";") {
+		tenant, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(tenant) != tenantID {
+			continue
+		}
+		if v, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && v >= 0 {
+			days = v
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// archiveBlock 将作答块的一次判卷归档到 MinIO：附件写入 assets/，判卷包写入 bundle.json
+func (sc *SubmitExamCase) archiveBlock(blockID string, attemptID int64) error {
+	ctx := context.Background()
+	var block struct {
+		ExamID        string         `db:"exam_id"`
+		ItemID        string         `db:"item_id"`
+		StudentID     string         `db:"student_id"`
+		SubmitID      string         `db:"submit_id"`
+		TenantID      string         `db:"tenant_id"`
+		Answer        pq.StringArray `db:"answer"`
+		AnswerObjects pq.StringArray `db:"answer_objects"`
+		AnswerText    string         `db:"answer_text"`
+		GradedAnswers pq.StringArray `db:"graded_answers"`
+	}
+	query := `
+		SELECT exam_id, item_id, student_id, submit_id, COALESCE(tenant_id, '') AS tenant_id, COALESCE(answer, '{}') AS answer,
+			COALESCE(answer_objects, '{}') AS answer_objects, COALESCE(answer_text, '') AS answer_text,
+			COALESCE(graded_answers, '{}') AS graded_answers
+		FROM exam_blocks WHERE block_id = $1
+`
+	if err := sc.db.Get(&block, query, blockID); err != nil {
+		return fmt.Errorf("load block: %w", err)
+	}
+	bundle := GradingBundle{
+		Version:    ARCHIVEBUNDLEVERSION,
+		BlockID:    blockID,
+		ExamID:     block.ExamID,
+		ItemID:     block.ItemID,
+		StudentID:  block.StudentID,
+		SubmitID:   block.SubmitID,
+		ArchivedAt: time.Now(),
+		Answer:     archiveAnswer{Text: block.AnswerText, GradedAnswers: block.GradedAnswers},
+	}
+	itemQuery := `
+		SELECT body, correct_answer, body_result, correct_answer_result, full_score, subject, question_type, rubric, content_hash
+		FROM exam_items WHERE item_id = $1
+`
+	if err := sc.db.Get(&bundle.Item, itemQuery, block.ItemID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("load item: %w", err)
+	}
+	attempts, err := sc.loadGradingAttempts("a.id = $1", attemptID)
+	if err != nil {
+		return fmt.Errorf("load attempt: %w", err)
+	}
+	if len(attempts) == 0 {
+		return fmt.Errorf("attempt %d not found", attemptID)
+	}
+	bundle.Attempt = attempts[0]
+
+	prefix := fmt.Sprintf("%s%s/%s/%d/", ARCHIVEPREFIX, block.ExamID, blockID, attemptID)
+	bundle.Answer.Images = make([]ArchiveAsset, 0, len(block.Answer))
+	for i, source := range block.Answer {
+		asset := ArchiveAsset{Page: i + 1, Source: source, Key: fmt.Sprintf("assets/page-%d", i+1)}
+		var object string
+		if i < len(block.AnswerObjects) {
+			object = block.AnswerObjects[i]
+		}
+		if err := sc.archiveAsset(ctx, block.TenantID, prefix, object, &asset); err != nil {
+			log.Printf("[archiveBlock] Failed to archive page %d of block %s: %v", i+1, blockID, err)
+			asset.Key, asset.Error = "", err.Error()
+		}
+		bundle.Answer.Images = append(bundle.Answer.Images, asset)
+	}
+
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := sc.minioClient.Put(ctx, prefix+ARCHIVEBUNDLEFILE, data, "application/json"); err != nil {
+		return err
+	}
+	var expiresAt sql.NullTime
+	if retention := archiveRetention(block.TenantID); retention > 0 {
+		expiresAt = sql.NullTime{Time: bundle.ArchivedAt.Add(retention), Valid: true}
+	}
+	insertQuery := `
+		INSERT INTO grading_archives (block_id, attempt_id, tenant_id, object_prefix, expires_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+		ON CONFLICT (attempt_id) DO UPDATE SET object_prefix = EXCLUDED.object_prefix, expires_at = EXCLUDED.expires_at, deleted_at = NULL
+`
+	_, err = sc.db.Exec(insertQuery, blockID, attemptID, block.TenantID, prefix, expiresAt)
+	return err
+}
+
+// archiveAsset 将一页作答图片放入判卷包：已转存 MinIO 的直接复制，否则从原始地址下载
+func (sc *SubmitExamCase) archiveAsset(ctx context.Context, tenantID, prefix, object string, asset *ArchiveAsset) error {
+	if object != "" {
+		if err := sc.minioClient.Copy(ctx, object, prefix+asset.Key); err != nil {
+			return err
+		}
+		asset.SHA256 = strings.TrimPrefix(object, ANSWEROBJECTPREFIX)
+		return nil
+	}
+	data, err := sc.urlPolicy.Fetch(ctx, tenantID, asset.Source)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	asset.SHA256 = hex.EncodeToString(sum[:])
+	asset.ContentType = http.DetectContentType(data)
+	asset.Size = int64(len(data))
+	return sc.minioClient.Put(ctx, prefix+asset.Key, data, asset.ContentType)
+}
+
+// ArchiveRetentionSweeper 定期删除超过保留期限的判卷包
+func (sc *SubmitExamCase) ArchiveRetentionSweeper() {
+	if sc.minioClient == nil {
+		return
+	}
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		var archives []GradingArchive
+		query := `
+			SELECT id, block_id, attempt_id, object_prefix, created_at, expires_at, deleted_at
+			FROM grading_archives
+			WHERE deleted_at IS NULL AND expires_at < NOW()
+			ORDER BY expires_at
+			LIMIT 500
+`
+		if err := sc.db.Select(&archives, query); err != nil {
+			log.Printf("[ArchiveRetentionSweeper] Query error: %v", err)
+			continue
+		}
+		for _, archive := range archives {
+			if err := sc.minioClient.RemovePrefix(context.Background(), archive.Prefix); err != nil {
+				log.Printf("[ArchiveRetentionSweeper] Failed to remove archive %d: %v", archive.ID, err)
+				continue
+			}
+			if _, err := sc.db.Exec(`UPDATE grading_archives SET deleted_at = NOW() WHERE id = $1`, archive.ID); err != nil {
+				log.Printf("[ArchiveRetentionSweeper] Update failed for archive %d: %v", archive.ID, err)
+			}
+		}
+		if len(archives) > 0 {
+			log.Printf("[ArchiveRetentionSweeper] Removed %d expired archives", len(archives))
+		}
+	}
+}
+
+// GetBlockArchiveController 返回作答块的判卷包，默认最近一次判卷，可用 attempt_id 指定。
+// 附件带有临时下载地址，供审计查看。只能查看 token 所属租户的判卷包
+func (sc *SubmitExamCase) GetBlockArchiveController(c *fiber.Ctx) error {
+	if sc.minioClient == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"code":    1,
+			"message": "Object storage is not configured",
+		})
+	}
+	var archive GradingArchive
+	query := `
+		SELECT id, block_id, attempt_id, object_prefix, created_at, expires_at, deleted_at
+		FROM grading_archives
+		WHERE block_id = $1 AND ($2 = 0 OR attempt_id = $2) AND COALESCE(tenant_id, '') = $3
+		ORDER BY attempt_id DESC
+		LIMIT 1
+`
+	err := sc.db.Get(&archive, query, c.Params("block_id"), c.QueryInt("attempt_id"), requestTenant(c))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"code":    1,
+			"message": "Archive not found",
+		})
+	}
+	if err != nil {
+		log.Printf("[GetBlockArchiveController] Query error: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if archive.DeletedAt != nil {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"code":    1,
+			"message": "Archive was removed after its retention period",
+		})
+	}
+
+	ctx := context.Background()
+	data, err := sc.minioClient.Get(ctx, archive.Prefix+ARCHIVEBUNDLEFILE)
+	if err != nil {
+		log.Printf("[GetBlockArchiveController] Failed to read archive %d: %v", archive.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Storage error")
+	}
+	var bundle GradingBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		log.Printf("[GetBlockArchiveController] Invalid archive %d: %v", archive.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Invalid archive")
+	}
+	for i, asset := range bundle.Answer.Images {
+		if asset.Key == "" {
+			continue
+		}
+		if bundle.Answer.Images[i].URL, err = sc.minioClient.PresignedGet(ctx, archive.Prefix+asset.Key, answerPresignExpiry()); err != nil {
+			log.Printf("[GetBlockArchiveController] Failed to presign %s: %v", asset.Key, err)
+		}
+	}
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"data": fiber.Map{
+			"archive": archive,
+			"bundle":  bundle,
+		},
+	})
+}
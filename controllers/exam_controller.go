@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	EXAMRECEIVED        = "received"
+	EXAMPREPROCESSING   = "preprocessing"
+	EXAMREADY           = "ready"
+	EXAMPARTIALLYFAILED = "partially_failed"
+	EXAMFAILED          = "failed"
+)
+
+// ExamItemStatus 是单道题目的预处理状态
+type ExamItemStatus struct {
+	ItemID    string    `json:"item_id" db:"item_id"`
+	Status    string    `json:"status" db:"status"`
+	Error     *string   `json:"error" db:"error"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ExamStatus 是试卷最近一次提交的生命周期状态
+type ExamStatus struct {
+	CardID    string           `json:"card_id" db:"exam_id"`
+	SubmitID  string           `json:"submit_id" db:"submit_id"`
+	TenantID  *string          `json:"-" db:"tenant_id"`
+	Callback  *string          `json:"-" db:"callback"`
+	Status    string           `json:"status" db:"status"`
+	ItemCount int              `json:"item_count" db:"item_count"`
+	CreatedAt time.Time        `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at" db:"updated_at"`
+	Items     []ExamItemStatus `json:"items" db:"-"`
+}
+
+// recordExamReceived 登记一次试卷提交；重复提交同一试卷时以新的 submit_id 重新开始
+func (sc *SubmitExamCase) recordExamReceived(tx *sqlx.Tx, examID, submitID, tenantID, callback string, itemCount int) error {
+	query := `
+		INSERT INTO exams (exam_id, submit_id, tenant_id, callback, status, item_count)
+		VALUES ($1, $2, NULLIF($3, ''), $4, 'received', $5)
+		ON CONFLICT (exam_id)
+		DO UPDATE SET
+			submit_id = EXCLUDED.submit_id,
+			tenant_id = EXCLUDED.tenant_id,
+			callback = EXCLUDED.callback,
+			status = 'received',
+			item_count = EXCLUDED.item_count
+`
+	_, err := tx.Exec(query, examID, submitID, tenantID, callback, itemCount)
+	return err
+}
+
+// markExamPreprocessing 题目全部入队后进入预处理阶段
+func (sc *SubmitExamCase) markExamPreprocessing(tx *sqlx.Tx, examID, submitID string) error {
+	query := `UPDATE exams SET status = 'preprocessing' WHERE exam_id = $1 AND submit_id = $2 AND status = 'received'`
+	_, err := tx.Exec(query, examID, submitID)
+	return err
+}
+
+// finishExamItem 记录题目预处理结果，全部题目处理完后确定试卷状态并回调。
+// 条件更新保证并发完成最后几道题时只有一个 worker 发出回调
+func (sc *SubmitExamCase) finishExamItem(task ExamItemTask, cause error) {
+	if cause != nil {
+		sc.markItemFailed(task.ItemID, task.SubmitId, cause)
+	} else {
+		sc.markItemReady(task.ItemID, task.SubmitId)
+	}
+	query := `
+		WITH counts AS (
+			SELECT
+				COUNT(*) FILTER (WHERE status = 'preparing') AS preparing,
+				COUNT(*) FILTER (WHERE status = 'failed') AS failed,
+				COUNT(*) AS total
+			FROM item_preparations
+			WHERE exam_id = $1 AND submit_id = $2
+		)
+		UPDATE exams e SET
+			status = CASE
+				WHEN c.failed = 0 THEN 'ready'
+				WHEN c.failed = c.total THEN 'failed'
+				ELSE 'partially_failed'
+			END
+		FROM counts c
+		WHERE e.exam_id = $1 AND e.submit_id = $2
+			AND e.status IN ('received', 'preprocessing')
+			AND c.preparing = 0
+		RETURNING e.status
+`
+	var status string
+	err := sc.db.QueryRow(query, task.ExamID, task.SubmitId).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("[finishExamItem] Update failed for exam %s: %v", task.ExamID, err)
+		return
+	}
+	log.Printf("[finishExamItem] Exam %s finished preprocessing: %s", task.ExamID, status)
+	exam, err := sc.examStatus(task.ExamID)
+	if err != nil {
+		log.Printf("[finishExamItem] Query error for exam %s: %v", task.ExamID, err)
+		return
+	}
+	sc.notifyExamCallback(exam)
+}
+
+// examStatus 查询试卷及其最近一次提交中各题目的预处理状态
+func (sc *SubmitExamCase) examStatus(examID string) (*ExamStatus, error) {
+	var exam ExamStatus
+	query := `
+		SELECT exam_id, submit_id, tenant_id, callback, status, item_count, created_at, updated_at
+		FROM exams WHERE exam_id = $1
+`
+	if err := sc.db.Get(&exam, query, examID); err != nil {
+		return nil, err
+	}
+	exam.Items = []ExamItemStatus{}
+	itemsQuery := `
+		SELECT item_id, status, error, updated_at
+		FROM item_preparations
+		WHERE exam_id = $1 AND submit_id = $2
+		ORDER BY item_id
+`
+	if err := sc.db.Select(&exam.Items, itemsQuery, exam.CardID, exam.SubmitID); err != nil {
+		return nil, err
+	}
+	return &exam, nil
+}
+
+// GetExamController 返回试卷的生命周期状态及各题目的预处理状态
+func (sc *SubmitExamCase) GetExamController(c *fiber.Ctx) error {
+	exam, err := sc.examStatus(c.Params("card_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"code":    1,
+			"message": "Exam not found",
+		})
+	}
+	if err != nil {
+		log.Printf("[GetExamController] Query error: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"data": exam,
+	})
+}
+
+// notifyExamCallback 推送试卷预处理结果。result 仅在全部题目成功时为 Done，否则为 Failed，
+// 具体失败的题目见 items
+func (sc *SubmitExamCase) notifyExamCallback(exam *ExamStatus) {
+	if exam.Callback == nil || *exam.Callback == "" {
+		return
+	}
+	result := "Done"
+	if exam.Status != EXAMREADY {
+		result = "Failed"
+	}
+	tenantID := ""
+	if exam.TenantID != nil {
+		tenantID = *exam.TenantID
+	}
+	payload := map[string]interface{}{
+		"card_id":   exam.CardID,
+		"submit_id": exam.SubmitID,
+		"result":    result,
+		"status":    exam.Status,
+		"items":     exam.Items,
+	}
+	payloadJson, _ := json.Marshal(payload)
+	resp, err := sc.urlPolicy.Post(context.Background(), tenantID, *exam.Callback, "application/json", payloadJson)
+	if err != nil {
+		log.Printf("[notifyExamCallback] POST request error: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("[notifyExamCallback] Callback returned non-200 status: %d", resp.StatusCode)
+	}
+}
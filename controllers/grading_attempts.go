@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"examination-papers/grading"
+	"examination-papers/utils"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	ATTEMPTTRIGGERSUBMIT = "submit"
+	ATTEMPTTRIGGERAPPEAL = "appeal"
+	ATTEMPTTRIGGERREVIEW = "review"
+)
+
+// GradingAttempt 是作答块的一次判卷结果
+type GradingAttempt struct {
+	ID            int64                 `json:"id" db:"id"`
+	Trigger       string                `json:"trigger" db:"trigger"`
+	AppealID      *int64                `json:"appeal_id" db:"appeal_id"`
+	Status        *string               `json:"status" db:"status"`
+	Score         decimal.NullDecimal   `json:"score" db:"score"`
+	FullScore     decimal.NullDecimal   `json:"full_score" db:"full_score"`
+	Result        *string               `json:"result" db:"result"`
+	Grader        *string               `json:"grader" db:"grader"`
+	Pipeline      *string               `json:"pipeline" db:"pipeline"`
+	PromptVersion *int                  `json:"prompt_version" db:"prompt_version"`
+	GraderOutput  *grading.GraderOutput `json:"grader_output" db:"grader_output"`
+	LatencyMS     *int64                `json:"latency_ms" db:"latency_ms"`
+	Error         *string               `json:"error" db:"error"`
+	CreatedAt     time.Time             `json:"created_at" db:"created_at"`
+	Calls         []GradingCall         `json:"calls" db:"-"`
+}
+
+// GradingCall 是判卷过程中的一次智能体调用
+type GradingCall struct {
+	AttemptID   int64               `json:"-" db:"attempt_id"`
+	Stage       string              `json:"stage" db:"stage"`
+	CallNo      int                 `json:"call_no" db:"call_no"`
+	Provider    string              `json:"provider" db:"provider"`
+	AppID       *string             `json:"app_id" db:"app_id"`
+	RequestID   *string             `json:"request_id" db:"request_id"`
+	SessionID   *string             `json:"session_id" db:"session_id"`
+	Prompt      *string             `json:"prompt" db:"prompt"`
+	Params      json.RawMessage     `json:"params" db:"params"`
+	RawOutput   *string             `json:"raw_output" db:"raw_output"`
+	ParsedScore decimal.NullDecimal `json:"parsed_score" db:"parsed_score"`
+	MaxScore    decimal.NullDecimal `json:"max_score" db:"max_score"`
+	LatencyMS   *int64              `json:"latency_ms" db:"latency_ms"`
+	Error       *string             `json:"error" db:"error"`
+}
+
+// attemptSnapshotQuery 将作答块 b 当前的判卷结果复制为一条历史记录
+const attemptSnapshotQuery = `
+		INSERT INTO grading_attempts (
+			block_id, submit_id, trigger, appeal_id, status, score, full_score, result, grader,
+			pipeline, prompt_template_id, prompt_version, grader_output
+		)
+		SELECT b.block_id, b.submit_id, $2, NULLIF($3, 0), b.status, b.score, b.full_score, b.result, b.grader,
+			b.pipeline_mode, b.prompt_template_id, b.prompt_version, b.grader_output
+		FROM exam_blocks b WHERE b.block_id = $1
+`
+
+// recordGradingAttempt 将作答块当前的判卷结果存为一条历史记录，返回记录 ID
+func (sc *SubmitExamCase) recordGradingAttempt(blockID, trigger string, appealID int64) (int64, error) {
+	var id int64
+	if err := sc.db.QueryRow(attemptSnapshotQuery+" RETURNING id", blockID, trigger, appealID).Scan(&id); err != nil {
+		log.Printf("[recordGradingAttempt] Insert failed for block %s: %v", blockID, err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// loadGradingAttempts 按条件查询判卷历史（grading_attempts 别名为 a）及每次判卷的智能体调用
+func (sc *SubmitExamCase) loadGradingAttempts(condition string, args ...interface{}) ([]GradingAttempt, error) {
+	query := `
+		SELECT a.id, a.trigger, a.appeal_id, a.status, a.score, a.full_score, a.result, a.grader, a.pipeline,
+			a.prompt_version, a.grader_output, a.latency_ms, a.error, a.created_at
+		FROM grading_attempts a WHERE ` + condition + `
+		ORDER BY a.id
+`
+	attempts := []GradingAttempt{}
+	if err := sc.db.Select(&attempts, query, args...); err != nil {
+		return nil, err
+	}
+	callsQuery := `
+		SELECT c.attempt_id, c.stage, c.call_no, c.provider, c.app_id, c.request_id, c.session_id, c.prompt, c.params,
+			c.raw_output, c.parsed_score, c.max_score, c.latency_ms, c.error
+		FROM grading_calls c JOIN grading_attempts a ON a.id = c.attempt_id
+		WHERE ` + condition + `
+		ORDER BY c.id
+`
+	var calls []GradingCall
+	if err := sc.db.Select(&calls, callsQuery, args...); err != nil {
+		return nil, err
+	}
+	byAttempt := map[int64][]GradingCall{}
+	for _, call := range calls {
+		byAttempt[call.AttemptID] = append(byAttempt[call.AttemptID], call)
+	}
+	for i := range attempts {
+		attempts[i].Calls = byAttempt[attempts[i].ID]
+		if attempts[i].Calls == nil {
+			attempts[i].Calls = []GradingCall{}
+		}
+	}
+	return attempts, nil
+}
+
+// recordGradingCalls 补充判卷历史的耗时与失败原因，并保存流水线中的每次智能体调用
+func (sc *SubmitExamCase) recordGradingCalls(attemptID int64, graded *agentGrading) {
+	var errText sql.NullString
+	if graded.err != nil {
+		errText = sql.NullString{String: graded.err.Error(), Valid: true}
+	}
+	updateQuery := `UPDATE grading_attempts SET latency_ms = $2, error = $3 WHERE id = $1`
+	if _, err := sc.db.Exec(updateQuery, attemptID, graded.duration.Milliseconds(), errText); err != nil {
+		log.Printf("[recordGradingCalls] Update failed for attempt %d: %v", attemptID, err)
+	}
+	insertQuery := `
+		INSERT INTO grading_calls (
+			attempt_id, stage, call_no, provider, app_id, request_id, session_id, prompt, params,
+			raw_output, parsed_score, max_score, latency_ms, error
+		) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8, $9, $10, $11, $12, $13, $14)
+`
+	for _, stage := range graded.run.Stages {
+		params, _ := json.Marshal(redactParams(stage.Params))
+		for _, call := range stage.Calls {
+			var requestID, sessionID string
+			var rawOutput, callErr sql.NullString
+			var score, maxScore decimal.NullDecimal
+			if call.AgentResult != nil {
+				requestID, sessionID = call.AgentResult.RequestID, call.AgentResult.SessionID
+				rawOutput = sql.NullString{String: call.AgentResult.Text, Valid: true}
+			}
+			if call.Output != nil {
+				score, maxScore = decimal.NewNullDecimal(call.Output.Score), decimal.NewNullDecimal(call.Output.MaxScore)
+			}
+			if call.Err != nil {
+				callErr = sql.NullString{String: call.Err.Error(), Valid: true}
+			}
+			_, err := sc.db.Exec(insertQuery, attemptID, stage.Name, call.Attempt, utils.AgentProvider, stage.AppID, requestID, sessionID,
+				stage.Prompt, params, rawOutput, score, maxScore, call.Duration.Milliseconds(), callErr)
+			if err != nil {
+				log.Printf("[recordGradingCalls] Insert failed for attempt %d: %v", attemptID, err)
+			}
+		}
+	}
+}
+
+// redactParams 将 data URL 形式的拼接图片替换为长度说明，避免历史表存入整张图片
+func redactParams(params map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		if s, ok := v.(string); ok && strings.HasPrefix(s, "data:") {
+			v = fmt.Sprintf("<data url, %d bytes>", len(s))
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
+
+// finishBlock 在作答块写回判卷结果后调用：记录判卷历史（经智能体判卷时包括每次调用）并归档判卷包，
+// 申诉重判时结束申诉并推送修改后的结果
+func (sc *SubmitExamCase) finishBlock(task ExamStudentAnswerTask, graded *agentGrading) {
+	trigger := ATTEMPTTRIGGERSUBMIT
+	if task.AppealID != 0 {
+		trigger = ATTEMPTTRIGGERAPPEAL
+	}
+	attemptID, err := sc.recordGradingAttempt(task.BlockID, trigger, task.AppealID)
+	if err == nil && graded != nil {
+		sc.recordGradingCalls(attemptID, graded)
+	}
+	if err == nil && sc.minioClient != nil {
+		go func() {
+			if err := sc.archiveBlock(task.BlockID, attemptID); err != nil {
+				log.Printf("[finishBlock] Failed to archive block %s: %v", task.BlockID, err)
+			}
+		}()
+	}
+	if task.AppealID != 0 {
+		sc.completeAppeal(task)
+	}
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+const IDEMPOTENCYHEADER = "Idempotency-Key"
+
+// idempotentRequest 标识一次可安全重试的提交
+type idempotentRequest struct {
+	tenantID    string
+	endpoint    string
+	key         string
+	requestHash string
+}
+
+// idempotencyTTL 读取 IDEMPOTENCY_TTL_HOURS，默认 24 小时，过期后相同的 key 视为新请求
+func idempotencyTTL() time.Duration {
+	if hours, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_TTL_HOURS")); err == nil && hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// idempotencyLease 读取 IDEMPOTENCY_LEASE_SECONDS，默认 120 秒。处理中的登记超过租期视为原请求已中断，允许重试接管
+func idempotencyLease() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_LEASE_SECONDS")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 2 * time.Minute
+}
+
+// naturalIdempotencyKey 由请求中标识提交对象的字段生成 key，用于请求头没有 Idempotency-Key 时识别重试
+func naturalIdempotencyKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return "natural:" + hex.EncodeToString(sum[:])
+}
+
+// answerIdempotencyKey 作答提交的自然 key：exam_id 与排序后的 block_id
+func answerIdempotencyKey(req SubmitAnswerRequest) string {
+	parts := make([]string, 0, len(req.StudentAnswers)+1)
+	for _, ans := range req.StudentAnswers {
+		parts = append(parts, ans.BlockID)
+	}
+	sort.Strings(parts)
+	return naturalIdempotencyKey(append([]string{req.ExamID}, parts...)...)
+}
+
+// claimIdempotency 登记本次请求。相同 key 的请求已完成时直接写回原响应并返回 replayed = true。
+// 请求头没有 Idempotency-Key 时使用 naturalKey（如 exam_id 与 block_id），naturalKey 为空（如强制重判）时不做幂等处理
+func (sc *SubmitExamCase) claimIdempotency(c *fiber.Ctx, endpoint, naturalKey string) (*idempotentRequest, bool, error) {
+	sum := sha256.Sum256(c.Body())
+	req := &idempotentRequest{
+		tenantID:    requestTenant(c),
+		endpoint:    endpoint,
+		key:         c.Get(IDEMPOTENCYHEADER),
+		requestHash: hex.EncodeToString(sum[:]),
+	}
+	explicit := req.key != ""
+	if !explicit {
+		if naturalKey == "" {
+			return nil, false, nil
+		}
+		req.key = naturalKey
+	}
+
+	// 原请求失败后会释放 key，查询时记录已不存在则重试一次
+	for attempt := 0; attempt < 2; attempt++ {
+		// 清理过期记录与租期已过仍未完成的登记后尝试占用 key
+		now := time.Now()
+		deleteQuery := `
+			DELETE FROM idempotency_keys
+			WHERE tenant_id = $1 AND endpoint = $2 AND idempotency_key = $3
+				AND (created_at < $4 OR (status_code IS NULL AND created_at < $5))
+`
+		if _, err := sc.db.Exec(deleteQuery, req.tenantID, req.endpoint, req.key, now.Add(-idempotencyTTL()), now.Add(-idempotencyLease())); err != nil {
+			log.Printf("[claimIdempotency] Delete failed: %v", err)
+		}
+		insertQuery := `
+			INSERT INTO idempotency_keys (tenant_id, endpoint, idempotency_key, request_hash)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING
+`
+		res, err := sc.db.Exec(insertQuery, req.tenantID, req.endpoint, req.key, req.requestHash)
+		if err != nil {
+			log.Printf("[claimIdempotency] Insert failed: %v", err)
+			return nil, true, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return req, false, nil
+		}
+
+		var requestHash string
+		var statusCode sql.NullInt64
+		var response []byte
+		selectQuery := `SELECT request_hash, status_code, response FROM idempotency_keys WHERE tenant_id = $1 AND endpoint = $2 AND idempotency_key = $3`
+		err = sc.db.QueryRow(selectQuery, req.tenantID, req.endpoint, req.key).Scan(&requestHash, &statusCode, &response)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			log.Printf("[claimIdempotency] Query error: %v", err)
+			return nil, true, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+		}
+		// 自然 key 只标识提交对象，请求体可以不同（如重新上传的扫描件）
+		if explicit && requestHash != req.requestHash {
+			return nil, true, c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"code":    1,
+				"message": IDEMPOTENCYHEADER + " was already used with a different request",
+			})
+		}
+		if !statusCode.Valid {
+			return nil, true, c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"code":    1,
+				"message": "The original request is still being processed",
+			})
+		}
+		c.Set("Idempotent-Replayed", "true")
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return nil, true, c.Status(int(statusCode.Int64)).Send(response)
+	}
+	return nil, true, c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"code":    1,
+		"message": "The request is being retried concurrently",
+	})
+}
+
+// settleIdempotency 在 handler 返回后调用：成功时保存响应供重试回放，失败时释放 key 允许客户端重试
+func (sc *SubmitExamCase) settleIdempotency(c *fiber.Ctx, req *idempotentRequest, handlerErr error) {
+	if req == nil {
+		return
+	}
+	status := c.Response().StatusCode()
+	if handlerErr != nil || status < 200 || status >= 300 {
+		deleteQuery := `DELETE FROM idempotency_keys WHERE tenant_id = $1 AND endpoint = $2 AND idempotency_key = $3`
+		if _, err := sc.db.Exec(deleteQuery, req.tenantID, req.endpoint, req.key); err != nil {
+			log.Printf("[settleIdempotency] Delete failed: %v", err)
+		}
+		return
+	}
+	updateQuery := `UPDATE idempotency_keys SET status_code = $4, response = $5 WHERE tenant_id = $1 AND endpoint = $2 AND idempotency_key = $3`
+	if _, err := sc.db.Exec(updateQuery, req.tenantID, req.endpoint, req.key, status, string(c.Response().Body())); err != nil {
+		log.Printf("[settleIdempotency] Update failed: %v", err)
+	}
+}
+
+// dedupeAnswerBlocks 检查请求中的 block_id 是否已提交过。全部属于同一次提交时写回该提交的 submit_id，
+// 部分已存在时返回 409 及冲突的 block_id；done 为 true 表示响应已写回
+func (sc *SubmitExamCase) dedupeAnswerBlocks(c *fiber.Ctx, req SubmitAnswerRequest) (bool, error) {
+	blockIDs := make([]string, 0, len(req.StudentAnswers))
+	for _, ans := range req.StudentAnswers {
+		blockIDs = append(blockIDs, ans.BlockID)
+	}
+	var existing []struct {
+		BlockID  string `db:"block_id"`
+		SubmitID string `db:"submit_id"`
+		ExamID   string `db:"exam_id"`
+	}
+	query := `SELECT block_id, submit_id, exam_id FROM exam_blocks WHERE block_id = ANY($1)`
+	if err := sc.db.Select(&existing, query, pq.Array(blockIDs)); err != nil {
+		log.Printf("[dedupeAnswerBlocks] Query error: %v", err)
+		return true, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if len(existing) == 0 {
+		return false, nil
+	}
+	sameSubmit := len(existing) == len(blockIDs)
+	conflicts := make([]string, 0, len(existing))
+	for _, block := range existing {
+		conflicts = append(conflicts, block.BlockID)
+		if block.SubmitID != existing[0].SubmitID || block.ExamID != req.ExamID {
+			sameSubmit = false
+		}
+	}
+	if sameSubmit {
+		return true, c.JSON(fiber.Map{
+			"code":      0,
+			"message":   "Submitted successfully",
+			"submit_id": existing[0].SubmitID,
+		})
+	}
+	return true, c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"code":      1,
+		"message":   "Some blocks were already submitted",
+		"block_ids": conflicts,
+	})
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const ITEMCACHEPREFIX = "item_preprocess:"
+
+// itemPreprocessResult 是题目预处理的产出，按内容摘要缓存
+type itemPreprocessResult struct {
+	BodyResult          string `json:"body_result" db:"body_result"`
+	CorrectAnswerResult string `json:"correct_answer_result" db:"correct_answer_result"`
+}
+
+// itemCacheTTL 读取 ITEM_CACHE_TTL_HOURS，默认 24 小时。Postgres 中的记录不过期
+func itemCacheTTL() time.Duration {
+	if hours, err := strconv.Atoi(os.Getenv("ITEM_CACHE_TTL_HOURS")); err == nil && hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// lookupItemCache 先查 Redis，未命中再查 Postgres 并回填 Redis
+func (sc *SubmitExamCase) lookupItemCache(ctx context.Context, hash string) (*itemPreprocessResult, bool) {
+	var cached itemPreprocessResult
+	if data, err := sc.redisClient.Get(ctx, ITEMCACHEPREFIX+hash).Bytes(); err == nil {
+		if err := json.Unmarshal(data, &cached); err == nil {
+			return &cached, true
+		}
+	}
+	query := `SELECT body_result, correct_answer_result FROM item_preprocess_cache WHERE content_hash = $1`
+	err := sc.db.GetContext(ctx, &cached, query, hash)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[lookupItemCache] Query error: %v", err)
+		}
+		return nil, false
+	}
+	sc.cacheItemInRedis(ctx, hash, cached)
+	return &cached, true
+}
+
+// storeItemCache 保存预处理结果，强制刷新时覆盖旧记录
+func (sc *SubmitExamCase) storeItemCache(ctx context.Context, hash string, result itemPreprocessResult) {
+	query := `
+		INSERT INTO item_preprocess_cache (content_hash, body_result, correct_answer_result)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (content_hash)
+		DO UPDATE SET
+			body_result = EXCLUDED.body_result,
+			correct_answer_result = EXCLUDED.correct_answer_result
+`
+	if _, err := sc.db.ExecContext(ctx, query, hash, result.BodyResult, result.CorrectAnswerResult); err != nil {
+		log.Printf("[storeItemCache] Upsert failed: %v", err)
+		return
+	}
+	sc.cacheItemInRedis(ctx, hash, result)
+}
+
+func (sc *SubmitExamCase) cacheItemInRedis(ctx context.Context, hash string, result itemPreprocessResult) {
+	data, _ := json.Marshal(result)
+	if err := sc.redisClient.Set(ctx, ITEMCACHEPREFIX+hash, data, itemCacheTTL()).Err(); err != nil {
+		log.Printf("[cacheItemInRedis] Redis set error: %v", err)
+	}
+}
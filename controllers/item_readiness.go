@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	ITEMPREPARING = "preparing"
+	ITEMREADY     = "ready"
+	ITEMFAILED    = "failed"
+)
+
+// itemPreparation 是写入 item_preparations 的一行
+type itemPreparation struct {
+	ItemID   string `db:"item_id"`
+	ExamID   string `db:"exam_id"`
+	SubmitID string `db:"submit_id"`
+}
+
+// parkedTaskTimeout 读取 PARKED_TASK_TIMEOUT_MINUTES，默认 30 分钟，超时仍未就绪的作答判为失败
+func parkedTaskTimeout() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("PARKED_TASK_TIMEOUT_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return 30 * time.Minute
+}
+
+// markItemsPreparing 在题目入队前登记为预处理中，之后到达的作答会等待预处理完成。
+// 已暂存的作答改为等待本次提交，旧提交的预处理结果不再释放它们
+func (sc *SubmitExamCase) markItemsPreparing(tx *sqlx.Tx, rows []itemPreparation) error {
+	query := `
+		INSERT INTO item_preparations (item_id, exam_id, submit_id, status)
+		VALUES (:item_id, :exam_id, :submit_id, 'preparing')
+		ON CONFLICT (item_id)
+		DO UPDATE SET
+			exam_id = EXCLUDED.exam_id,
+			submit_id = EXCLUDED.submit_id,
+			status = 'preparing',
+			error = NULL
+`
+	if _, err := tx.NamedExec(query, rows); err != nil {
+		return err
+	}
+	itemIDs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		itemIDs = append(itemIDs, row.ItemID)
+	}
+	retag := `
+		UPDATE parked_answer_tasks p SET submit_id = i.submit_id
+		FROM item_preparations i
+		WHERE p.item_id = i.item_id AND p.item_id = ANY($1) AND p.submit_id <> i.submit_id
+`
+	_, err := tx.Exec(retag, pq.Array(itemIDs))
+	return err
+}
+
+// parkAnswerTask 题目仍在预处理时暂存作答任务并返回 true。
+// 锁住题目状态行，与 markItemReady 互斥，避免任务在题目就绪的瞬间被暂存而无人释放
+func (sc *SubmitExamCase) parkAnswerTask(task ExamStudentAnswerTask) (bool, error) {
+	tx, err := sc.db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var status, submitID string
+	err = tx.QueryRow(`SELECT status, submit_id FROM item_preparations WHERE item_id = $1 FOR SHARE`, task.ItemID).Scan(&status, &submitID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && status != ITEMPREPARING) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	payload, _ := json.Marshal(task)
+	query := `INSERT INTO parked_answer_tasks (item_id, block_id, submit_id, payload) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(query, task.ItemID, task.BlockID, submitID, string(payload)); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// itemPreparationStatus 返回题目的预处理状态及失败原因，没有记录时返回空串
+func (sc *SubmitExamCase) itemPreparationStatus(itemID string) (string, string, error) {
+	var status string
+	var reason sql.NullString
+	err := sc.db.QueryRow(`SELECT status, error FROM item_preparations WHERE item_id = $1`, itemID).Scan(&status, &reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil
+	}
+	return status, reason.String, err
+}
+
+// markItemReady 标记题目就绪，并将等待该次提交的作答重新入队。
+// 题目已被更新的提交接管时不做任何修改
+func (sc *SubmitExamCase) markItemReady(itemID, submitID string) {
+	tx, err := sc.db.Beginx()
+	if err != nil {
+		log.Printf("[markItemReady] DB error: %v", err)
+		return
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(`UPDATE item_preparations SET status = 'ready', error = NULL WHERE item_id = $1 AND submit_id = $2`, itemID, submitID)
+	if err != nil {
+		log.Printf("[markItemReady] Update failed for item %s: %v", itemID, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		log.Printf("[markItemReady] Item %s has moved on from submission %s, skip", itemID, submitID)
+		return
+	}
+	var payloads []string
+	query := `DELETE FROM parked_answer_tasks WHERE item_id = $1 AND submit_id = $2 RETURNING payload::text`
+	if err := tx.Select(&payloads, query, itemID, submitID); err != nil {
+		log.Printf("[markItemReady] Release failed for item %s: %v", itemID, err)
+		return
+	}
+	if err := enqueueTx(tx, STUDENTANSWERSQUEUE, payloads); err != nil {
+		log.Printf("[markItemReady] Enqueue failed for item %s: %v", itemID, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[markItemReady] Commit failed for item %s: %v", itemID, err)
+		return
+	}
+	if len(payloads) > 0 {
+		log.Printf("[markItemReady] Released %d parked answers for item %s", len(payloads), itemID)
+		sc.kickOutbox()
+	}
+}
+
+// markItemFailed 标记题目预处理失败，等待该次提交的作答一并判为失败。
+// 题目已被更新的提交接管时不做任何修改
+func (sc *SubmitExamCase) markItemFailed(itemID, submitID string, cause error) {
+	query := `UPDATE item_preparations SET status = 'failed', error = $3 WHERE item_id = $1 AND submit_id = $2`
+	result, err := sc.db.Exec(query, itemID, submitID, cause.Error())
+	if err != nil {
+		log.Printf("[markItemFailed] Update failed for item %s: %v", itemID, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		log.Printf("[markItemFailed] Item %s has moved on from submission %s, skip", itemID, submitID)
+		return
+	}
+	sc.failParkedTasks(`DELETE FROM parked_answer_tasks WHERE item_id = $1 AND submit_id = $2 RETURNING payload::text`,
+		"题目预处理失败，请检查！", itemID, submitID)
+}
+
+// ParkedTaskSweeper 定期将等待超时的作答判为失败
+func (sc *SubmitExamCase) ParkedTaskSweeper() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		sc.failParkedTasks(`DELETE FROM parked_answer_tasks WHERE parked_at < $1 RETURNING payload::text`,
+			"题目预处理超时，请检查！", time.Now().Add(-parkedTaskTimeout()))
+	}
+}
+
+func (sc *SubmitExamCase) failParkedTasks(query, reason string, args ...interface{}) {
+	var payloads []string
+	if err := sc.db.Select(&payloads, query, args...); err != nil {
+		log.Printf("[failParkedTasks] Query error: %v", err)
+		return
+	}
+	for _, payload := range payloads {
+		var task ExamStudentAnswerTask
+		if err := json.Unmarshal([]byte(payload), &task); err != nil {
+			log.Printf("[failParkedTasks] JSON decode failed: %v", err)
+			continue
+		}
+		sc.failBlock(task, reason)
+	}
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// outboxBatchSize 每次转发的最大消息数
+const outboxBatchSize = 100
+
+// outboxPollInterval 读取 OUTBOX_POLL_INTERVAL_MS，默认 1 秒。提交事务后会立即唤醒转发，轮询用于兜底
+func outboxPollInterval() time.Duration {
+	if ms, err := strconv.Atoi(os.Getenv("OUTBOX_POLL_INTERVAL_MS")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return time.Second
+}
+
+// enqueueTx 在事务中写入待投递的队列消息，事务提交后由 OutboxRelay 推入 Redis
+func enqueueTx(tx *sqlx.Tx, queue string, payloads []string) error {
+	if len(payloads) == 0 {
+		return nil
+	}
+	query := `INSERT INTO outbox (queue, payload) SELECT $1, p::jsonb FROM unnest($2::text[]) WITH ORDINALITY AS t(p, n) ORDER BY n`
+	_, err := tx.Exec(query, queue, pq.Array(payloads))
+	return err
+}
+
+// kickOutbox 唤醒转发协程，不阻塞调用方
+func (sc *SubmitExamCase) kickOutbox() {
+	select {
+	case sc.outboxNotify <- struct{}{}:
+	default:
+	}
+}
+
+// OutboxRelay 持续将 outbox 中未投递的消息按写入顺序推入 Redis。
+// 多个实例并行运行时通过 SKIP LOCKED 分摊；推送成功但标记前进程退出会导致重复投递，worker 需容忍重复任务
+func (sc *SubmitExamCase) OutboxRelay() {
+	ticker := time.NewTicker(outboxPollInterval())
+	defer ticker.Stop()
+	lastCleanup := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-sc.outboxNotify:
+		}
+		for {
+			n, err := sc.relayOutboxBatch(context.Background())
+			if err != nil {
+				log.Printf("[OutboxRelay] Relay failed: %v", err)
+				break
+			}
+			if n < outboxBatchSize {
+				break
+			}
+		}
+		if time.Since(lastCleanup) > time.Hour {
+			lastCleanup = time.Now()
+			if _, err := sc.db.Exec(`DELETE FROM outbox WHERE published_at < NOW() - INTERVAL '7 days'`); err != nil {
+				log.Printf("[OutboxRelay] Cleanup failed: %v", err)
+			}
+		}
+	}
+}
+
+func (sc *SubmitExamCase) relayOutboxBatch(ctx context.Context) (int, error) {
+	tx, err := sc.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var messages []struct {
+		ID      int64  `db:"id"`
+		Queue   string `db:"queue"`
+		Payload string `db:"payload"`
+	}
+	query := `
+		SELECT id, queue, payload::text AS payload FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+`
+	if err := tx.Select(&messages, query, outboxBatchSize); err != nil {
+		return 0, err
+	}
+	var published []int64
+	for _, msg := range messages {
+		if err := sc.redisClient.RPush(ctx, msg.Queue, msg.Payload).Err(); err != nil {
+			log.Printf("[OutboxRelay] Failed to push message %d to %s: %v", msg.ID, msg.Queue, err)
+			if _, err := tx.Exec(`UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1`, msg.ID, err.Error()); err != nil {
+				return 0, err
+			}
+			// 保持顺序，剩余消息留到下一轮
+			break
+		}
+		published = append(published, msg.ID)
+	}
+	if len(published) > 0 {
+		if _, err := tx.Exec(`UPDATE outbox SET published_at = NOW(), attempts = attempts + 1 WHERE id = ANY($1)`, pq.Array(published)); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(published), nil
+}
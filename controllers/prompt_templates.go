@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"examination-papers/grading"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type CreatePromptTemplateRequest struct {
+	Subject string `json:"subject" validate:"required"` // 学科
+	Body    string `json:"body" validate:"required"`    // text/template 模板
+}
+
+type ActivatePromptRequest struct {
+	Subject string `json:"subject" validate:"required"`      // 学科
+	Version int    `json:"version" validate:"required,gt=0"` // 启用的版本
+}
+
+type PinPromptRequest struct {
+	Subject string `json:"subject" validate:"required"`      // 学科
+	Version int    `json:"version" validate:"required,gt=0"` // 固定使用的版本
+}
+
+// CreatePromptTemplateController 为学科新增一个 prompt 版本，版本号自动递增。
+// 新版本默认不生效，需启用或由考试固定后才会用于判卷
+func (sc *SubmitExamCase) CreatePromptTemplateController(c *fiber.Ctx) error {
+	var req CreatePromptTemplateRequest
+	if failure := bindAndValidate(c, &req); failure != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(failure)
+	}
+	if _, err := grading.ParsePromptTemplate(req.Body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code":    1,
+			"message": "Invalid prompt template: " + err.Error(),
+		})
+	}
+	// 并发创建同一学科时由 (subject, version) 唯一约束兜底
+	query := `
+		INSERT INTO prompt_templates (subject, version, body)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2 FROM prompt_templates WHERE subject = $1
+		RETURNING id, subject, version, body, active, created_at
+`
+	var tmpl grading.PromptTemplate
+	if err := sc.db.Get(&tmpl, query, grading.NormalizeSubject(req.Subject), req.Body); err != nil {
+		log.Printf("[CreatePromptTemplateController] Insert failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed for prompt template")
+	}
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"data": tmpl,
+	})
+}
+
+// ListPromptTemplatesController 按学科列出 prompt 版本，最新版本在前
+func (sc *SubmitExamCase) ListPromptTemplatesController(c *fiber.Ctx) error {
+	query := `SELECT id, subject, version, body, active, created_at FROM prompt_templates WHERE subject = $1 ORDER BY version DESC`
+	templates := []grading.PromptTemplate{}
+	if err := sc.db.Select(&templates, query, grading.NormalizeSubject(c.Query("subject"))); err != nil {
+		log.Printf("[ListPromptTemplatesController] Query error: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"data": templates,
+	})
+}
+
+// ActivatePromptController 启用学科的指定 prompt 版本，未固定版本的考试之后改用该版本判卷
+func (sc *SubmitExamCase) ActivatePromptController(c *fiber.Ctx) error {
+	var req ActivatePromptRequest
+	if failure := bindAndValidate(c, &req); failure != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(failure)
+	}
+	subject := grading.NormalizeSubject(req.Subject)
+	tx, err := sc.db.Beginx()
+	if err != nil {
+		log.Printf("[ActivatePromptController] Begin failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+	// 锁住该学科的全部版本，串行化并发启用
+	var versions []int
+	if err := tx.Select(&versions, `SELECT version FROM prompt_templates WHERE subject = $1 FOR UPDATE`, subject); err != nil {
+		log.Printf("[ActivatePromptController] Query error: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	found := false
+	for _, v := range versions {
+		found = found || v == req.Version
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"code":    1,
+			"message": "Prompt template version not found",
+		})
+	}
+	if _, err := tx.Exec(`UPDATE prompt_templates SET active = FALSE WHERE subject = $1 AND active`, subject); err != nil {
+		log.Printf("[ActivatePromptController] Deactivate failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if _, err := tx.Exec(`UPDATE prompt_templates SET active = TRUE WHERE subject = $1 AND version = $2`, subject, req.Version); err != nil {
+		log.Printf("[ActivatePromptController] Activate failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[ActivatePromptController] Commit failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	return c.JSON(fiber.Map{
+		"code":    0,
+		"message": "Prompt activated successfully",
+	})
+}
+
+// PinPromptController 将考试某学科固定到指定 prompt 版本，之后的判卷不再跟随启用的版本
+func (sc *SubmitExamCase) PinPromptController(c *fiber.Ctx) error {
+	var req PinPromptRequest
+	if failure := bindAndValidate(c, &req); failure != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(failure)
+	}
+	query := `
+		INSERT INTO exam_prompt_pins (exam_id, subject, prompt_template_id)
+		SELECT $1, subject, id FROM prompt_templates WHERE subject = $2 AND version = $3
+		ON CONFLICT (exam_id, subject)
+		DO UPDATE SET prompt_template_id = EXCLUDED.prompt_template_id
+`
+	res, err := sc.db.Exec(query, c.Params("exam_id"), grading.NormalizeSubject(req.Subject), req.Version)
+	if err != nil {
+		log.Printf("[PinPromptController] Upsert failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"code":    1,
+			"message": "Prompt template version not found",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"code":    0,
+		"message": "Prompt pinned successfully",
+	})
+}
+
+// selectPromptTemplate 返回考试在该学科下应使用的 prompt：指定 version 时使用该版本，
+// 否则优先固定的版本，再次使用启用的版本。都没有时返回 nil，由调用方使用判卷配置中的 prompt
+func (sc *SubmitExamCase) selectPromptTemplate(examID, subject string, version int) (*grading.PromptTemplate, error) {
+	query := `
+		SELECT t.id, t.subject, t.version, t.body, t.active, t.created_at
+		FROM prompt_templates t
+		LEFT JOIN exam_prompt_pins p ON p.prompt_template_id = t.id AND p.exam_id = $1
+		WHERE t.subject = $2 AND ($3 = 0 OR t.version = $3) AND ($3 <> 0 OR p.exam_id IS NOT NULL OR t.active)
+		ORDER BY (p.exam_id IS NOT NULL) DESC
+		LIMIT 1
+`
+	var tmpl grading.PromptTemplate
+	err := sc.db.Get(&tmpl, query, examID, grading.NormalizeSubject(subject), version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tmpl, nil
+}
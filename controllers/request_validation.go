@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"examination-papers/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// bindAndValidate 解析请求体并执行 validate 标签校验，所有 handler 共用。
+// 返回非 nil 时为应直接写回的 400 响应体
+func bindAndValidate(c *fiber.Ctx, req interface{}) fiber.Map {
+	if err := c.BodyParser(req); err != nil {
+		return fiber.Map{
+			"code":    1,
+			"message": "Invalid request body",
+		}
+	}
+	if fieldErrors := utils.ValidateStruct(req); fieldErrors != nil {
+		return fiber.Map{
+			"code":    1,
+			"message": "Request validation failed",
+			"errors":  fieldErrors,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"examination-papers/grading"
+	"examination-papers/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// REVIEWERCLAIM 复核人取自 JWT 的 sub claim
+const REVIEWERCLAIM = "sub"
+
+// ReviewItem 是复核队列中的一个作答块
+type ReviewItem struct {
+	BlockID       string              `json:"block_id" db:"block_id"`
+	ExamID        string              `json:"exam_id" db:"exam_id"`
+	ItemID        string              `json:"item_id" db:"item_id"`
+	StudentID     string              `json:"student_id" db:"student_id"`
+	Status        string              `json:"status" db:"status"`
+	Score         decimal.NullDecimal `json:"score" db:"score"`
+	FullScore     decimal.NullDecimal `json:"full_score" db:"full_score"`
+	Result        *string             `json:"result" db:"result"`
+	Confidence    *float64            `json:"confidence" db:"confidence"`
+	Answer        pq.StringArray      `json:"answer" db:"answer"`
+	AnswerText    *string             `json:"answer_text" db:"answer_text"`
+	ReviewStatus  string              `json:"review_status" db:"review_status"`
+	ReviewReasons pq.StringArray      `json:"review_reasons" db:"review_reasons"`
+	ClaimedBy     *string             `json:"claimed_by" db:"review_claimed_by"`
+	ClaimedAt     *time.Time          `json:"claimed_at" db:"review_claimed_at"`
+}
+
+type OverrideRequest struct {
+	Score  *decimal.Decimal `json:"score" validate:"required_without=Result,omitempty,gte=0"` // 修改后的分数
+	Result string           `json:"result"`                                                   // 修改后的评语
+	Reason string           `json:"reason" validate:"required"`                               // 修改原因，记入审计
+}
+
+// ListReviewsController 列出 token 所属租户待复核的作答块，可按 exam_id、status（pending / claimed / resolved）过滤
+func (sc *SubmitExamCase) ListReviewsController(c *fiber.Ctx) error {
+	status := c.Query("status", "pending")
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	query := `
+		SELECT block_id, exam_id, item_id, student_id, status, score, full_score, result, confidence,
+			answer, answer_text, review_status, COALESCE(review_reasons, '{}') AS review_reasons,
+			review_claimed_by, review_claimed_at
+		FROM exam_blocks
+		WHERE review_status = $1 AND ($2 = '' OR exam_id = $2) AND COALESCE(tenant_id, '') = $4
+		ORDER BY updated_at
+		LIMIT $3
+`
+	items := []ReviewItem{}
+	if err := sc.db.Select(&items, query, status, c.Query("exam_id"), limit, requestTenant(c)); err != nil {
+		log.Printf("[ListReviewsController] Query error: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"data": items,
+	})
+}
+
+// ClaimReviewController 认领 token 所属租户待复核的作答块，已被他人认领时返回 409
+func (sc *SubmitExamCase) ClaimReviewController(c *fiber.Ctx) error {
+	reviewer := middleware.TokenClaim(c, REVIEWERCLAIM)
+	if reviewer == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"code":    1,
+			"message": "Token has no reviewer " + REVIEWERCLAIM + " claim",
+		})
+	}
+	query := `
+		UPDATE exam_blocks SET
+			review_status = 'claimed',
+			review_claimed_by = $2,
+			review_claimed_at = NOW()
+		WHERE block_id = $1 AND COALESCE(tenant_id, '') = $3
+			AND (review_status = 'pending' OR (review_status = 'claimed' AND review_claimed_by = $2))
+`
+	res, err := sc.db.Exec(query, c.Params("block_id"), reviewer, requestTenant(c))
+	if err != nil {
+		log.Printf("[ClaimReviewController] Update failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"code":    1,
+			"message": "Block is not awaiting review or is claimed by another reviewer",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"code":    0,
+		"message": "Review claimed successfully",
+	})
+}
+
+// OverrideReviewController 由认领人修改 token 所属租户作答块的分数 / 评语，写入审计记录并推送 result_updated 回调
+func (sc *SubmitExamCase) OverrideReviewController(c *fiber.Ctx) error {
+	reviewer := middleware.TokenClaim(c, REVIEWERCLAIM)
+	if reviewer == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"code":    1,
+			"message": "Token has no reviewer " + REVIEWERCLAIM + " claim",
+		})
+	}
+	var req OverrideRequest
+	if failure := bindAndValidate(c, &req); failure != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(failure)
+	}
+	blockID := c.Params("block_id")
+
+	tx, err := sc.db.Beginx()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	var current struct {
+		Status         string              `db:"status"`
+		Score          decimal.NullDecimal `db:"score"`
+		FullScore      decimal.NullDecimal `db:"full_score"`
+		ModelFullScore decimal.NullDecimal `db:"model_full_score"`
+		Rubric         grading.Rubric      `db:"rubric"`
+		Result         *string             `db:"result"`
+		ReviewStatus   *string             `db:"review_status"`
+		ClaimedBy      *string             `db:"review_claimed_by"`
+	}
+	// 以题目提交时的满分为准，题目缺少满分时退回作答块记录的满分
+	query := `
+		SELECT b.status, b.score, COALESCE(i.full_score, b.full_score) AS full_score, b.model_full_score, i.rubric,
+			b.result, b.review_status, b.review_claimed_by
+		FROM exam_blocks b
+		LEFT JOIN exam_items i ON i.item_id = b.item_id
+		WHERE b.block_id = $1 AND COALESCE(b.tenant_id, '') = $2
+		FOR UPDATE OF b
+`
+	if err := tx.Get(&current, query, blockID, requestTenant(c)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"code":    1,
+				"message": "Block not found",
+			})
+		}
+		log.Printf("[OverrideReviewController] Query error: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if current.ReviewStatus == nil || *current.ReviewStatus != "claimed" || current.ClaimedBy == nil || *current.ClaimedBy != reviewer {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"code":    1,
+			"message": "Block must be claimed by the reviewer before overriding",
+		})
+	}
+
+	score := current.Score
+	if req.Score != nil {
+		// 题目与作答块都没有满分时依次退回评分细则总分、模型给出的满分，都没有时只要求分数非负
+		fullScore := current.FullScore
+		if !fullScore.Valid && !current.Rubric.IsEmpty() {
+			fullScore = decimal.NewNullDecimal(current.Rubric.Total())
+		}
+		if !fullScore.Valid || !fullScore.Decimal.IsPositive() {
+			fullScore = current.ModelFullScore
+		}
+		var err error
+		if fullScore.Valid && fullScore.Decimal.IsPositive() {
+			err = grading.CheckScore(*req.Score, fullScore.Decimal)
+		} else if req.Score.IsNegative() {
+			err = fmt.Errorf("%w: score %s is negative", grading.ErrScoreOutOfRange, req.Score)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"code":    1,
+				"message": err.Error(),
+			})
+		}
+		score = decimal.NewNullDecimal(*req.Score)
+	}
+	result := current.Result
+	if req.Result != "" {
+		result = &req.Result
+	}
+
+	auditQuery := `
+		INSERT INTO block_overrides (block_id, reviewer, reason, previous_status, previous_score, previous_result, score, result)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+`
+	if _, err := tx.Exec(auditQuery, blockID, reviewer, req.Reason, current.Status, current.Score, current.Result, score, result); err != nil {
+		log.Printf("[OverrideReviewController] Audit insert failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	// 人工给出分数后视为判卷成功
+	status := current.Status
+	if score.Valid {
+		status = "true"
+	}
+	updateQuery := `
+		UPDATE exam_blocks SET
+			status = $2,
+			score = $3,
+			result = $4,
+			grader = 'human',
+			review_status = 'resolved'
+		WHERE block_id = $1
+`
+	if _, err := tx.Exec(updateQuery, blockID, status, score, result); err != nil {
+		log.Printf("[OverrideReviewController] Update failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Commit failed")
+	}
+
+	sc.recordGradingAttempt(blockID, ATTEMPTTRIGGERREVIEW, 0)
+	go sc.notifyBlockUpdated(blockID)
+	return c.JSON(fiber.Map{
+		"code":    0,
+		"message": "Override saved successfully",
+	})
+}
+
+// notifyBlockUpdated 向作答块所属提交的回调地址推送单个作答块的最新结果
+func (sc *SubmitExamCase) notifyBlockUpdated(blockID string) {
+	var task ExamStudentAnswerTask
+	query := `SELECT submit_id, exam_id, callback, COALESCE(tenant_id, '') FROM exam_blocks WHERE block_id = $1`
+	if err := sc.db.QueryRow(query, blockID).Scan(&task.SubmitId, &task.ExamID, &task.Callback, &task.TenantID); err != nil {
+		log.Printf("[notifyBlockUpdated] Query error for block %s: %v", blockID, err)
+		return
+	}
+	blocks, err := sc.listExamBlocks("block_id = $1", blockID)
+	if err != nil {
+		return
+	}
+	sc.notifyCallbackEvent(task, blocks, "result_updated")
+}
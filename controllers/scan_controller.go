@@ -0,0 +1,330 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"examination-papers/grading"
+	"examination-papers/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// ScanIngestRequest 是扫描件上传的表单字段，文件放在 file 字段
+type ScanIngestRequest struct {
+	StudentID    string `json:"student_id" form:"student_id" validate:"required"`
+	Callback     string `json:"callback" form:"callback" validate:"required,url"`
+	ForceRegrade bool   `json:"force_regrade" form:"force_regrade"`
+}
+
+// scanMaxBytes 读取 SCAN_MAX_BYTES，默认单个扫描件不超过 30MB，需小于 SERVER_BODY_LIMIT
+func scanMaxBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("SCAN_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return 30 << 20
+}
+
+// scanMaxUncompressedBytes 读取 SCAN_MAX_UNCOMPRESSED_BYTES，默认 ZIP 扫描件解压后总计不超过 200MB
+func scanMaxUncompressedBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("SCAN_MAX_UNCOMPRESSED_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return 200 << 20
+}
+
+// scanMaxZipEntries ZIP 扫描件中最多的条目数
+const scanMaxZipEntries = 1000
+
+// scanBlockID 扫描件生成的作答块 ID，同一学生重复上传同一试卷时按 block_id 去重
+func scanBlockID(examID, studentID, itemID string) string {
+	return examID + ":" + studentID + ":" + itemID
+}
+
+// PutExamLayoutController 设置试卷的答题卡版面
+func (sc *SubmitExamCase) PutExamLayoutController(c *fiber.Ctx) error {
+	var layout grading.ScanLayout
+	if failure := bindAndValidate(c, &layout); failure != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(failure)
+	}
+	if err := layout.Check(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code":    1,
+			"message": err.Error(),
+		})
+	}
+	examID := c.Params("exam_id")
+	unknown, err := sc.unknownExamItems(examID, layout.Items())
+	if err != nil {
+		log.Printf("[PutExamLayoutController] Query error: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if len(unknown) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code":    1,
+			"message": "Items do not belong to exam " + examID + ": " + strings.Join(unknown, ", "),
+		})
+	}
+	query := `
+		INSERT INTO exam_layouts (exam_id, layout) VALUES ($1, $2)
+		ON CONFLICT (exam_id) DO UPDATE SET layout = EXCLUDED.layout
+`
+	if _, err := sc.db.Exec(query, examID, layout); err != nil {
+		log.Printf("[PutExamLayoutController] Upsert failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	return c.JSON(fiber.Map{
+		"code":    0,
+		"message": "Layout saved successfully",
+	})
+}
+
+// GetExamLayoutController 返回试卷的答题卡版面
+func (sc *SubmitExamCase) GetExamLayoutController(c *fiber.Ctx) error {
+	layout, err := sc.examLayout(c.Params("exam_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"code":    1,
+			"message": "Layout not found",
+		})
+	}
+	if err != nil {
+		log.Printf("[GetExamLayoutController] Query error: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"data": layout,
+	})
+}
+
+// unknownExamItems 返回不属于该试卷的题目，仍在预处理中的题目也视为属于试卷
+func (sc *SubmitExamCase) unknownExamItems(examID string, itemIDs []string) ([]string, error) {
+	query := `
+		SELECT item_id FROM exam_items WHERE exam_id = $1 AND item_id = ANY($2)
+		UNION
+		SELECT item_id FROM item_preparations WHERE exam_id = $1 AND item_id = ANY($2)
+`
+	var known []string
+	if err := sc.db.Select(&known, query, examID, pq.Array(itemIDs)); err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(known))
+	for _, itemID := range known {
+		found[itemID] = true
+	}
+	var unknown []string
+	for _, itemID := range itemIDs {
+		if !found[itemID] {
+			unknown = append(unknown, itemID)
+		}
+	}
+	return unknown, nil
+}
+
+func (sc *SubmitExamCase) examLayout(examID string) (grading.ScanLayout, error) {
+	var layout grading.ScanLayout
+	err := sc.db.QueryRow(`SELECT layout FROM exam_layouts WHERE exam_id = $1`, examID).Scan(&layout)
+	return layout, err
+}
+
+// IngestScanController 接收一名学生整份答题卡的扫描件（PDF 或图片 ZIP），按版面切分为各题作答图片存入 MinIO，
+// 生成 StudentAnswer 走与 /submit_student_answer 相同的判卷流程
+func (sc *SubmitExamCase) IngestScanController(c *fiber.Ctx) (err error) {
+	if failure := sc.objectStorageFailure(); failure != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(failure)
+	}
+	// 切分出的作答图片存为当前租户的直传对象
+	tenantID := requestTenant(c)
+	if failure := uploadTenantFailure(tenantID); failure != nil {
+		return c.Status(fiber.StatusForbidden).JSON(failure)
+	}
+	var req ScanIngestRequest
+	if failure := bindAndValidate(c, &req); failure != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(failure)
+	}
+	examID := c.Params("exam_id")
+	ctx := context.Background()
+	if err := sc.urlPolicy.Validate(ctx, tenantID, req.Callback); err != nil {
+		log.Printf("[IngestScanController] Callback rejected by url policy: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code":    1,
+			"message": "Callback url is not allowed",
+		})
+	}
+	layout, err := sc.examLayout(examID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"code":    1,
+			"message": "Layout not found for exam " + examID,
+		})
+	}
+	if err != nil {
+		log.Printf("[IngestScanController] Query error: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	data, err := readScanFile(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code":    1,
+			"message": err.Error(),
+		})
+	}
+
+	// 未带 Idempotency-Key 时按试卷与学生识别重试；强制重判时重新处理
+	naturalKey := ""
+	if !req.ForceRegrade {
+		naturalKey = naturalIdempotencyKey(examID, req.StudentID)
+	}
+	idem, replayed, err := sc.claimIdempotency(c, "ingest_scan", naturalKey)
+	if replayed {
+		return err
+	}
+	defer func() { sc.settleIdempotency(c, idem, err) }()
+
+	answerReq := SubmitAnswerRequest{
+		ExamID:       examID,
+		Callback:     req.Callback,
+		ForceRegrade: req.ForceRegrade,
+	}
+	for _, itemID := range layout.Items() {
+		answerReq.StudentAnswers = append(answerReq.StudentAnswers, StudentAnswer{
+			BlockID:   scanBlockID(examID, req.StudentID, itemID),
+			StudentID: req.StudentID,
+			ItemID:    itemID,
+		})
+	}
+	// 先按 block_id 去重，重复或冲突的提交不会切分扫描件，也不会在 MinIO 留下无人引用的对象
+	if done, err := sc.dedupeAnswerBlocks(c, answerReq); done {
+		return err
+	}
+
+	pages, totalPages, err := splitScanPages(data, layout.Pages())
+	if err != nil {
+		log.Printf("[IngestScanController] Failed to split scan: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code":    1,
+			"message": "Failed to read scan: " + err.Error(),
+		})
+	}
+	if len(pages) < layout.Pages() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code":    1,
+			"message": fmt.Sprintf("Scan has %d pages, layout expects %d", len(pages), layout.Pages()),
+		})
+	}
+
+	if totalPages > len(pages) {
+		log.Printf("[IngestScanController] Scan for exam %s has %d pages, ignored %d beyond the layout", examID, totalPages, totalPages-len(pages))
+	}
+
+	// 按版面裁剪各题作答区域，每页只解码一次；全部裁剪成功后再上传，以直传对象的形式引用
+	decoded := map[int]image.Image{}
+	crops := make([][]byte, len(layout.Regions))
+	for i, region := range layout.Regions {
+		crops[i] = pages[region.Page-1]
+		if region.Box == nil {
+			continue
+		}
+		page, ok := decoded[region.Page]
+		if !ok {
+			if page, err = utils.DecodeScanImage(pages[region.Page-1]); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"code":    1,
+					"message": fmt.Sprintf("Failed to decode page %d: %v", region.Page, err),
+				})
+			}
+			decoded[region.Page] = page
+		}
+		if crops[i], err = utils.CropImage(page, region.Box.X, region.Box.Y, region.Box.Width, region.Box.Height); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"code":    1,
+				"message": fmt.Sprintf("Failed to crop region %d on page %d: %v", i, region.Page, err),
+			})
+		}
+	}
+	answerList := map[string][]string{}
+	for i, region := range layout.Regions {
+		key := newUploadObjectKey(tenantID)
+		if err := sc.minioClient.Put(ctx, key, crops[i], http.DetectContentType(crops[i])); err != nil {
+			log.Printf("[IngestScanController] %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "Storage error")
+		}
+		answerList[region.ItemID] = append(answerList[region.ItemID], key)
+	}
+	for i := range answerReq.StudentAnswers {
+		answerReq.StudentAnswers[i].AnswerList = answerList[answerReq.StudentAnswers[i].ItemID]
+	}
+
+	submitId, err := sc.submitStudentAnswers(ctx, answerReq, tenantID)
+	if errors.Is(err, errAnswerImages) {
+		log.Printf("[IngestScanController] %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code":    1,
+			"message": err.Error(),
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{
+		"code":            0,
+		"message":         "Submitted successfully",
+		"submit_id":       submitId,
+		"pages":           len(pages),
+		"ignored_pages":   totalPages - len(pages),
+		"student_answers": answerReq.StudentAnswers,
+	})
+}
+
+// readScanFile 读取表单中的扫描件
+func readScanFile(c *fiber.Ctx) ([]byte, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, errors.New("missing scan file")
+	}
+	maxBytes := scanMaxBytes()
+	if header.Size > maxBytes {
+		return nil, fmt.Errorf("scan file exceeds %d bytes", maxBytes)
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, errors.New("failed to read scan file")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return nil, errors.New("failed to read scan file")
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("scan file exceeds %d bytes", maxBytes)
+	}
+	return data, nil
+}
+
+// splitScanPages 按文件头识别 PDF 或 ZIP，拆分出前 maxPages 页图片，同时返回扫描件的总页数
+func splitScanPages(data []byte, maxPages int) ([][]byte, int, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF")):
+		return utils.ExtractPDFPageImages(data, maxPages)
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return utils.ExtractZipImages(data, utils.ZipLimits{
+			MaxEntries:    scanMaxZipEntries,
+			MaxFileBytes:  uploadMaxBytes(),
+			MaxTotalBytes: scanMaxUncompressedBytes(),
+			MaxPages:      maxPages,
+		})
+	}
+	return nil, 0, errors.New("scan must be a PDF or a ZIP of images")
+}
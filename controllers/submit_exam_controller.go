@@ -1,10 +1,13 @@
 package controllers
 
 import (
-	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"examination-papers/data/storage"
+	"examination-papers/grading"
+	"examination-papers/middleware"
 	"examination-papers/utils"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
@@ -13,116 +16,202 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
 	"log"
-	"net/http"
-	"os"
+	"strings"
 	"time"
 )
 
 const QUESTIONTASKSQUEUE = "question_tasks_queue"
 const STUDENTANSWERSQUEUE = "student_answers_queue"
-const SUBMITIDEXAMSUB = "submit_exam:"
 const SUBMITIDANSWERSUB = "submit:answer:"
+const TENANTCLAIM = "tenant_id"
+
+// requestTenant 返回经 JWT 认证的租户，未认证的请求租户为空。不信任请求头中的租户
+func requestTenant(c *fiber.Ctx) string {
+	return middleware.TokenClaim(c, TENANTCLAIM)
+}
 
 // get env
-var HANDLEANSWERAPPID = os.Getenv("HANDLE_ANSWER_APPID")
-var HANDLEQUESTIONAPPID = os.Getenv("HANDLE_QUESTION_APPID")
-var EXAMPAPERSMATHAPPID = os.Getenv("EXAM_PAPER_MATH_APPID")
-var HANDLESCOREAPPID = os.Getenv("HANDLE_SCORE_APPID")
 
 type SubmitExamCase struct {
 	db          *sqlx.DB
 	minioClient *storage.MinioClient
 	redisClient *redis.Client
+	urlPolicy   *utils.URLPolicy
+	registry    *grading.Registry
+
+	outboxNotify chan struct{} // 唤醒 OutboxRelay
 }
 
-func NewSubmitExamCase(db *sqlx.DB, minioClient *storage.MinioClient, redisClient *redis.Client) *SubmitExamCase {
+func NewSubmitExamCase(db *sqlx.DB, minioClient *storage.MinioClient, redisClient *redis.Client, registry *grading.Registry) *SubmitExamCase {
 	return &SubmitExamCase{
 		db:          db,
 		minioClient: minioClient,
 		redisClient: redisClient,
+		urlPolicy:   utils.NewURLPolicyFromEnv(),
+		registry:    registry,
+
+		outboxNotify: make(chan struct{}, 1),
 	}
 }
 
 type SubmitExamRequest struct {
 	CardID   string `json:"card_id" validate:"required"`
-	Callback string `json:"callback" validate:"required"`   // 回调地址
-	Items    []Item `json:"items" validate:"required,dive"` // List of questions
+	Subject  string `json:"subject"`                              // 学科，如 math / english，默认 math
+	Callback string `json:"callback" validate:"required,url"`     // 回调地址
+	Items    []Item `json:"items" validate:"required,min=1,dive"` // List of questions
+
+	ForceRefresh bool `json:"force_refresh"` // 忽略预处理缓存，重新调用智能体
 }
 
 type Item struct {
-	ItemID    string `json:"item_id" validate:"required"`    // Question ID
-	Body      string `json:"body" validate:"required"`       // Question body
-	Analysis  string `json:"analysis" validate:"required"`   // Question analysis
-	Answer    string `json:"answer" validate:"required"`     // Question answer
-	FullScore string `json:"full_score" validate:"required"` // Maximum score for the question
+	ItemID    string          `json:"item_id" validate:"required"`                                                           // Question ID
+	Body      string          `json:"body" validate:"required"`                                                              // Question body
+	Analysis  string          `json:"analysis" validate:"required"`                                                          // Question analysis
+	Answer    string          `json:"answer" validate:"required"`                                                            // Question answer
+	FullScore decimal.Decimal `json:"full_score" validate:"required,gt=0"`                                                   // Maximum score for the question
+	Subject   string          `json:"subject"`                                                                               // Overrides the exam subject for this item
+	Type      string          `json:"type" validate:"omitempty,oneof=single_choice multiple_choice true_false numeric open"` // Question type, defaults to open
+	Tolerance float64         `json:"tolerance" validate:"gte=0"`                                                            // Absolute tolerance for numeric questions
+	Rubric    grading.Rubric  `json:"rubric"`                                                                                // Optional scoring criteria, points must add up to full_score
 }
 
 type SubmitAnswerRequest struct {
 	ExamID         string          `json:"exam_id" validate:"required"`      // 考试ID
 	Callback       string          `json:"callback" validate:"required,url"` // 回调地址
-	StudentAnswers []StudentAnswer `json:"student_answers" validate:"required,dive"`
+	StudentAnswers []StudentAnswer `json:"student_answers" validate:"required,min=1,dive"`
+
+	ForceRegrade bool `json:"force_regrade"` // 不复用相同作答的历史判卷结果
 }
 
 type StudentAnswer struct {
-	BlockID    string   `json:"block_id" validate:"required"`             // 唯一ID
-	StudentID  string   `json:"student_id" validate:"required"`           // 学生ID
-	ItemID     string   `json:"item_id" validate:"required"`              // 试题ID
-	AnswerList []string `json:"answer_list" validate:"required,dive,url"` // 学生作答图片列表
+	BlockID    string   `json:"block_id" validate:"required"`                                                       // 唯一ID
+	StudentID  string   `json:"student_id" validate:"required"`                                                     // 学生ID
+	ItemID     string   `json:"item_id" validate:"required"`                                                        // 试题ID
+	AnswerList []string `json:"answer_list" validate:"required_without=AnswerText,omitempty,min=1,dive,answer_ref"` // 学生作答图片列表，URL 或直传得到的对象 key
+	AnswerText string   `json:"answer_text"`                                                                        // 已识别的作答文本，客观题可直接本地判分
 }
 
 type ExamItemTask struct {
-	ExamID    string `json:"exam_id" validate:"required"` // Exam ID
-	ItemID    string `json:"item_id" validate:"required"` // Question ID
-	Body      string `json:"body" validate:"required"`    // Question body
-	Analysis  string `json:"analysis" validate:"required"`
-	Answer    string `json:"answer" validate:"required"`     // Question answer
-	SubmitId  string `json:"submit_id" validate:"required"`  // Unique ID for the submission
-	CallBack  string `json:"callback" validate:"required"`   // Callback URL for result notification
-	FullScore string `json:"full_score" validate:"required"` // Maximum score for the question
+	ExamID    string          `json:"exam_id" validate:"required"` // Exam ID
+	ItemID    string          `json:"item_id" validate:"required"` // Question ID
+	Body      string          `json:"body" validate:"required"`    // Question body
+	Analysis  string          `json:"analysis" validate:"required"`
+	Answer    string          `json:"answer" validate:"required"`          // Question answer
+	SubmitId  string          `json:"submit_id" validate:"required"`       // Unique ID for the submission
+	CallBack  string          `json:"callback" validate:"required"`        // Callback URL for result notification
+	FullScore decimal.Decimal `json:"full_score" validate:"required,gt=0"` // Maximum score for the question
+	TenantID  string          `json:"tenant_id"`                           // Tenant used for URL policy checks
+	Subject   string          `json:"subject"`                             // Subject used to pick the grading app
+	Type      string          `json:"type"`                                // Question type
+	Tolerance float64         `json:"tolerance"`                           // Absolute tolerance for numeric questions
+	Rubric    grading.Rubric  `json:"rubric"`                              // Scoring criteria
+
+	ForceRefresh bool `json:"force_refresh"` // Skip the preprocessing cache
 }
 
 type ExamStudentAnswerTask struct {
-	BlockID   string   `json:"block_id" validate:"required"`        // Unique ID for the answer block
-	ExamID    string   `json:"exam_id" validate:"required"`         // Exam ID
-	ItemID    string   `json:"item_id" validate:"required"`         // Question ID
-	StudentID string   `json:"student_id" validate:"required"`      // Student ID
-	Answers   []string `json:"answer" validate:"required,dive,url"` // Student's answer list (image URLs)
-	SubmitId  string   `json:"submit_id" validate:"required"`       // Unique ID for the submission
-	Callback  string   `json:"callback" validate:"required,url"`    // Callback URL for result notification
+	BlockID    string   `json:"block_id" validate:"required"`                                                  // Unique ID for the answer block
+	ExamID     string   `json:"exam_id" validate:"required"`                                                   // Exam ID
+	ItemID     string   `json:"item_id" validate:"required"`                                                   // Question ID
+	StudentID  string   `json:"student_id" validate:"required"`                                                // Student ID
+	Answers    []string `json:"answer" validate:"required_without=AnswerText,omitempty,min=1,dive,answer_ref"` // Student's answer list (image URLs or upload object keys)
+	AnswerText string   `json:"answer_text"`                                                                   // Recognized answer text, if any
+	SubmitId   string   `json:"submit_id" validate:"required"`                                                 // Unique ID for the submission
+	Callback   string   `json:"callback" validate:"required,url"`                                              // Callback URL for result notification
+	TenantID   string   `json:"tenant_id"`                                                                     // Tenant used for URL policy checks
+
+	AnswerObjects []string `json:"answer_objects,omitempty"` // MinIO keys of the stored answer images, same order as Answers
+
+	ForceRegrade bool `json:"force_regrade"` // Skip reusing results of identical answers
+
+	AppealID      int64  `json:"appeal_id,omitempty"`      // Set when the task regrades an appealed block
+	AppID         string `json:"app_id,omitempty"`         // Grading app overriding the subject profile
+	Pipeline      string `json:"pipeline,omitempty"`       // Pipeline overriding the subject profile
+	PromptVersion int    `json:"prompt_version,omitempty"` // Prompt template version overriding the exam's
+}
+
+// examBlockRow 是批量写入 exam_blocks 的一行
+type examBlockRow struct {
+	SubmitID   string         `db:"submit_id"`
+	BlockID    string         `db:"block_id"`
+	ExamID     string         `db:"exam_id"`
+	StudentID  string         `db:"student_id"`
+	ItemID     string         `db:"item_id"`
+	Answer     pq.StringArray `db:"answer"`
+	Objects    pq.StringArray `db:"answer_objects"`
+	Callback   string         `db:"callback"`
+	AnswerText string         `db:"answer_text"`
+	TenantID   string         `db:"tenant_id"`
 }
 
 type ExamBlockResponse struct {
-	BlockID   string `json:"block_id"`   // Unique ID for the answer block
-	ItemID    string `json:"item_id"`    // Question ID
-	StudentID string `json:"student_id"` // Student ID
-	Result    string `json:"result"`     // Result of the answer evaluation
-	Score     string `json:"score"`      // Score awarded for the answer
-	FullScore string `json:"full_score"` // Maximum score for the question
-	Status    string `json:"status"`     // Status of the evaluation (e.g., "success", "failed")
+	BlockID           string                `json:"block_id"`            // Unique ID for the answer block
+	ItemID            string                `json:"item_id"`             // Question ID
+	StudentID         string                `json:"student_id"`          // Student ID
+	Result            string                `json:"result"`              // Result of the answer evaluation
+	Score             decimal.NullDecimal   `json:"score"`               // Score awarded for the answer, null when not scored
+	FullScore         decimal.NullDecimal   `json:"full_score"`          // Maximum score for the question
+	FullScoreMismatch bool                  `json:"full_score_mismatch"` // Model disagreed with the item's full score
+	GradedAnswers     []string              `json:"graded_answers"`      // Answer images considered during grading
+	ScoreBreakdown    grading.Breakdown     `json:"score_breakdown"`     // Per-criterion scores when the item has a rubric
+	GraderOutput      *grading.GraderOutput `json:"grader_output"`       // Structured grader output, null when not scored by an agent
+	CacheHit          bool                  `json:"cache_hit"`           // Result was reused from an identical earlier answer
+	Status            string                `json:"status"`              // Status of the evaluation (e.g., "success", "failed")
 }
 
-func (sc *SubmitExamCase) SubmitExamController(c *fiber.Ctx) error {
+func (sc *SubmitExamCase) SubmitExamController(c *fiber.Ctx) (err error) {
 	var req SubmitExamRequest
 	log.Printf("[SubmitExamController] Received request: %s", c.Body())
-	if err := c.BodyParser(&req); err != nil {
+	if failure := bindAndValidate(c, &req); failure != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(failure)
+	}
+	if fieldErrors := sc.validateItems(&req); fieldErrors != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"code":    1,
-			"message": "Invalid request body",
+			"message": "Request validation failed",
+			"errors":  fieldErrors,
 		})
 	}
-
-	if req.CardID == "" || len(req.Items) == 0 {
+	ctx := context.Background()
+	tenantID := requestTenant(c)
+	if err := sc.urlPolicy.Validate(ctx, tenantID, req.Callback); err != nil {
+		log.Printf("[SubmitExamController] Callback rejected by url policy: %v", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"code":    1,
-			"message": "Exam ID and items are required",
+			"message": "Callback url is not allowed",
 		})
 	}
-	ctx := context.Background()
+	// 客户端超时重试时返回首次提交的结果，不重复入队
+	// 未带 Idempotency-Key 时内容完全相同的重试视为同一请求；强制刷新时每次都重新处理
+	naturalKey := ""
+	if !req.ForceRefresh {
+		naturalKey = naturalIdempotencyKey(req.CardID, string(c.Body()))
+	}
+	idem, replayed, err := sc.claimIdempotency(c, "submit_exam", naturalKey)
+	if replayed {
+		return err
+	}
+	defer func() { sc.settleIdempotency(c, idem, err) }()
+
 	submitId := uuid.NewString()
 	log.Printf("[SubmitExamController] len items: %d", len(req.Items))
-	sc.redisClient.Set(ctx, SUBMITIDEXAMSUB+submitId, len(req.Items), 4*time.Hour)
+	// 试卷登记、题目状态与入队在同一事务中完成，避免登记成功但任务丢失
+	tx, err := sc.db.Beginx()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+	if err := sc.recordExamReceived(tx, req.CardID, submitId, tenantID, req.Callback, len(req.Items)); err != nil {
+		log.Printf("[SubmitExamController] Failed to record exam: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	// 先登记题目为预处理中，预处理完成前到达的作答会等待
+	preparations := make([]itemPreparation, 0, len(req.Items))
+	payloads := make([]string, 0, len(req.Items))
 	for _, item := range req.Items {
+		preparations = append(preparations, itemPreparation{ItemID: item.ItemID, ExamID: req.CardID, SubmitID: submitId})
 		task := ExamItemTask{
 			ExamID:    req.CardID,
 			ItemID:    item.ItemID,
@@ -132,6 +221,13 @@ func (sc *SubmitExamCase) SubmitExamController(c *fiber.Ctx) error {
 			FullScore: item.FullScore,
 			CallBack:  req.Callback,
 			SubmitId:  submitId,
+			TenantID:  tenantID,
+			Subject:   itemSubject(req, item),
+			Type:      itemType(item),
+			Tolerance: item.Tolerance,
+			Rubric:    item.Rubric,
+
+			ForceRefresh: req.ForceRefresh,
 		}
 		taskBytes, err := json.Marshal(task)
 		if err != nil {
@@ -140,19 +236,33 @@ func (sc *SubmitExamCase) SubmitExamController(c *fiber.Ctx) error {
 				"message": "Failed to serialize task",
 			})
 		}
-
-		err = sc.redisClient.LPush(ctx, QUESTIONTASKSQUEUE, taskBytes).Err()
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"code":    1,
-				"message": "Failed to add task to queue",
-			})
-		}
+		payloads = append(payloads, string(taskBytes))
+	}
+	if err := sc.markItemsPreparing(tx, preparations); err != nil {
+		log.Printf("[SubmitExamController] Failed to record item preparations: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if err := enqueueTx(tx, QUESTIONTASKSQUEUE, payloads); err != nil {
+		log.Printf("[SubmitExamController] Failed to enqueue items: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"code":    1,
+			"message": "Failed to add task to queue",
+		})
+	}
+	if err := sc.markExamPreprocessing(tx, req.CardID, submitId); err != nil {
+		log.Printf("[SubmitExamController] Failed to update exam status: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Commit failed")
 	}
+	sc.kickOutbox()
 
 	return c.JSON(fiber.Map{
-		"code":    0,
-		"message": "Task submitted successfully",
+		"code":      0,
+		"message":   "Task submitted successfully",
+		"submit_id": submitId,
+		"status":    EXAMPREPROCESSING,
 	})
 }
 
@@ -176,36 +286,60 @@ func (sc *SubmitExamCase) SubmitExamWorker() {
 			log.Printf("[Worker] JSON decode failed: %v", err)
 			continue
 		}
+		if fieldErrors := utils.ValidateStruct(&examTask); fieldErrors != nil {
+			log.Printf("[Worker] Invalid exam task %s: %+v", examTask.ItemID, fieldErrors)
+			if examTask.ItemID != "" {
+				sc.finishExamItem(examTask, fmt.Errorf("invalid exam task: %+v", fieldErrors))
+			}
+			continue
+		}
 		log.Printf("[Worker] Processing exam: %s, items: %s", examTask.ExamID, examTask.ItemID)
 
-		// 构造调用参数
-		bizParams := map[string]interface{}{
-			"answer":     examTask.Answer,
-			"full_score": examTask.FullScore,
-			"analysis":   examTask.Analysis,
-		}
-		// 处理 answer
-		answerResp, err := utils.RetryAgentRequest(HANDLEANSWERAPPID, bizParams, 3)
+		// 按流水线定义预处理标准答案与题干，内容未变时复用之前的结果
+		pipeline, err := sc.registry.Pipeline(grading.PipelineExamItem)
 		if err != nil {
-			log.Printf("[Worker] AgentRequest error: %v", err)
+			log.Printf("[Worker] %v", err)
+			sc.finishExamItem(examTask, err)
 			continue
 		}
-
-		// 调用外部api 处理 body
-		bodyParams := map[string]interface{}{
-			"question": examTask.Body,
+		content := map[string]interface{}{
+			"answer":     examTask.Answer,
+			"full_score": examTask.FullScore.String(),
+			"analysis":   examTask.Analysis,
+			"body":       examTask.Body,
+			"subject":    examTask.Subject,
 		}
-		// 处理 原问题
-		bodyResp, err := utils.RetryAgentRequest(HANDLEQUESTIONAPPID, bodyParams, 3)
-		if err != nil {
-			log.Printf("[Worker] AgentRequest error for body: %v", err)
-			continue
+		contentHash := grading.ContentHash(pipeline, content)
+		var preprocessed *itemPreprocessResult
+		hit := false
+		if !examTask.ForceRefresh {
+			preprocessed, hit = sc.lookupItemCache(ctx, contentHash)
+		}
+		if hit {
+			log.Printf("[Worker] Reusing preprocessing results for item %s", examTask.ItemID)
+		} else {
+			vars := map[string]interface{}{"item_id": examTask.ItemID, "exam_id": examTask.ExamID}
+			for k, v := range content {
+				vars[k] = v
+			}
+			run, err := pipeline.Run(ctx, grading.Profile{}, vars, utils.AgentRequestContext)
+			if err != nil {
+				log.Printf("[Worker] AgentRequest error: %v", err)
+				sc.finishExamItem(examTask, err)
+				continue
+			}
+			preprocessed = &itemPreprocessResult{
+				BodyResult:          run.Text("body_result"),
+				CorrectAnswerResult: run.Text("correct_answer_result"),
+			}
+			sc.storeItemCache(ctx, contentHash, *preprocessed)
 		}
 
 		query := `
 		INSERT INTO exam_items (
-			exam_id, item_id, body, correct_answer, body_result, correct_answer_result
-		) VALUES ($1, $2, $3, $4, $5, $6)
+			exam_id, item_id, body, correct_answer, body_result, correct_answer_result, full_score, subject,
+			question_type, tolerance, rubric, content_hash
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		ON CONFLICT (item_id)
 		DO UPDATE SET
 		exam_id = EXCLUDED.exam_id,
@@ -213,39 +347,97 @@ func (sc *SubmitExamCase) SubmitExamWorker() {
 			correct_answer = EXCLUDED.correct_answer,
 			body_result = EXCLUDED.body_result,
 			correct_answer_result = EXCLUDED.correct_answer_result,
+			full_score = EXCLUDED.full_score,
+			subject = EXCLUDED.subject,
+			question_type = EXCLUDED.question_type,
+			tolerance = EXCLUDED.tolerance,
+			rubric = EXCLUDED.rubric,
+			content_hash = EXCLUDED.content_hash,
 			updated_at = NOW()
 `
-		_, err = sc.db.Exec(query, examTask.ExamID, examTask.ItemID, examTask.Body, examTask.Answer, bodyResp.Text, answerResp.Text)
-		remaining, err := sc.redisClient.Decr(ctx, SUBMITIDEXAMSUB+examTask.SubmitId).Result()
+		_, err = sc.db.Exec(query, examTask.ExamID, examTask.ItemID, examTask.Body, examTask.Answer, preprocessed.BodyResult, preprocessed.CorrectAnswerResult, examTask.FullScore, examTask.Subject,
+			examTask.Type, examTask.Tolerance, examTask.Rubric, contentHash)
 		if err != nil {
 			log.Printf("[Worker] Failed to insert exam item: %v", err)
-			continue
+		} else {
+			log.Printf("[Worker] Successfully processed exam item: %s", examTask.ItemID)
 		}
+		sc.finishExamItem(examTask, err)
+	}
+}
 
-		log.Printf("[Worker] Successfully processed exam item: %s", examTask.ItemID)
-
-		if remaining <= 0 {
-			lockKey := "submit_exam:lock:" + examTask.SubmitId
-			ok, _ := sc.redisClient.SetNX(ctx, lockKey, "1", 40*time.Second).Result()
-			if ok {
-				// 执行回调
-				sc.notifyExamCallback(examTask)
+func (sc *SubmitExamCase) SubmitAnswerController(c *fiber.Ctx) (err error) {
+	var req SubmitAnswerRequest
+	if failure := bindAndValidate(c, &req); failure != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(failure)
+	}
 
-				sc.redisClient.Del(ctx, SUBMITIDEXAMSUB+examTask.SubmitId)
-				sc.redisClient.Del(ctx, lockKey)
+	// 入队前校验回调地址与作答图片地址
+	ctx := context.Background()
+	tenantID := requestTenant(c)
+	if err := sc.urlPolicy.Validate(ctx, tenantID, req.Callback); err != nil {
+		log.Printf("[SubmitAnswerController] Callback rejected by url policy: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code":    1,
+			"message": "Callback url is not allowed",
+		})
+	}
+	for _, ans := range req.StudentAnswers {
+		for _, answerURL := range ans.AnswerList {
+			if err := sc.validateAnswerRef(ctx, tenantID, answerURL); err != nil {
+				log.Printf("[SubmitAnswerController] Answer url rejected: %v", err)
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"code":    1,
+					"message": fmt.Sprintf("Answer url is not allowed for block %s", ans.BlockID),
+				})
 			}
 		}
 	}
-}
 
-func (sc *SubmitExamCase) SubmitAnswerController(c *fiber.Ctx) error {
-	var req SubmitAnswerRequest
-	if err := c.BodyParser(&req); err != nil {
+	// 未带 Idempotency-Key 时按 exam_id 与 block_id 识别重试；强制重判是有意的重新提交，不回放
+	naturalKey := ""
+	if !req.ForceRegrade {
+		naturalKey = answerIdempotencyKey(req)
+	}
+	idem, replayed, err := sc.claimIdempotency(c, "submit_student_answer", naturalKey)
+	if replayed {
+		return err
+	}
+	defer func() { sc.settleIdempotency(c, idem, err) }()
+	// 按 block_id 去重：整批已提交过时返回原 submit_id，部分已提交时明确拒绝，避免事务中途失败
+	if done, err := sc.dedupeAnswerBlocks(c, req); done {
+		return err
+	}
+
+	submitId, err := sc.submitStudentAnswers(ctx, req, tenantID)
+	if errors.Is(err, errAnswerImages) {
+		log.Printf("[SubmitAnswerController] %v", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"code":    1,
-			"message": "Invalid request body",
+			"message": err.Error(),
 		})
 	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{
+		"code":      0,
+		"message":   "Submitted successfully",
+		"submit_id": submitId,
+	})
+}
+
+// errAnswerImages 表示作答图片无法下载或读取，属于请求错误
+var errAnswerImages = errors.New("failed to fetch answer images")
+
+// submitStudentAnswers 写入作答块并在同一事务中入队判卷任务，返回本次提交的 submit_id。
+// 调用方负责校验请求与按 block_id 去重
+func (sc *SubmitExamCase) submitStudentAnswers(ctx context.Context, req SubmitAnswerRequest, tenantID string) (string, error) {
+	// 源地址的图片可能过期，先转存到 MinIO，之后判卷与重判都从 MinIO 读取
+	answerObjects, err := sc.persistAnswerImages(ctx, tenantID, req.StudentAnswers)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errAnswerImages, err)
+	}
 
 	submitId := uuid.NewString()
 	initialCount := len(req.StudentAnswers)
@@ -255,46 +447,80 @@ func (sc *SubmitExamCase) SubmitAnswerController(c *fiber.Ctx) error {
 	initialCountKey := fmt.Sprintf("initial_count:%s", submitId)
 	sc.redisClient.Set(context.Background(), initialCountKey, initialCount, 120*time.Second)
 
-	tx, err := sc.db.Beginx()
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
-	}
-
-	// todo : 换成批量插入
+	rows := make([]examBlockRow, 0, len(req.StudentAnswers))
+	payloads := make([]string, 0, len(req.StudentAnswers))
 	for _, ans := range req.StudentAnswers {
-		query := `INSERT INTO exam_blocks 
-			(submit_id, block_id, exam_id, student_id, item_id, answer, callback, status) 
-			VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending')`
-		_, err := tx.Exec(query, submitId, ans.BlockID, req.ExamID, ans.StudentID, ans.ItemID, pq.Array(ans.AnswerList), req.Callback)
-		if err != nil {
-			tx.Rollback()
-			log.Printf("[SubmitAnswerController] Insert failed for student answer: %v", err)
-			return fiber.NewError(fiber.StatusInternalServerError, "Insert failed for student answer")
+		if ans.AnswerList == nil {
+			ans.AnswerList = []string{}
 		}
-
-		// 同步推入 Redis 队列（每道题为单位）
+		rows = append(rows, examBlockRow{
+			SubmitID:   submitId,
+			BlockID:    ans.BlockID,
+			ExamID:     req.ExamID,
+			StudentID:  ans.StudentID,
+			ItemID:     ans.ItemID,
+			Answer:     ans.AnswerList,
+			Objects:    answerObjects[ans.BlockID],
+			Callback:   req.Callback,
+			AnswerText: ans.AnswerText,
+			TenantID:   tenantID,
+		})
+		// 每道题为一个任务
 		task := ExamStudentAnswerTask{
-			BlockID:   ans.BlockID,
-			ExamID:    req.ExamID,
-			ItemID:    ans.ItemID,
-			StudentID: ans.StudentID,
-			Answers:   ans.AnswerList,
-			Callback:  req.Callback,
-			SubmitId:  submitId,
+			BlockID:    ans.BlockID,
+			ExamID:     req.ExamID,
+			ItemID:     ans.ItemID,
+			StudentID:  ans.StudentID,
+			Answers:    ans.AnswerList,
+			AnswerText: ans.AnswerText,
+			Callback:   req.Callback,
+			SubmitId:   submitId,
+			TenantID:   tenantID,
+
+			AnswerObjects: answerObjects[ans.BlockID],
+			ForceRegrade:  req.ForceRegrade,
 		}
 		payload, _ := json.Marshal(task)
-		sc.redisClient.RPush(context.Background(), STUDENTANSWERSQUEUE, payload)
+		payloads = append(payloads, string(payload))
 	}
 
+	// 作答块与队列消息在同一事务中写入，提交后才会被转发到 Redis
+	tx, err := sc.db.Beginx()
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+	query := `INSERT INTO exam_blocks
+		(submit_id, block_id, exam_id, student_id, item_id, answer, answer_objects, callback, status, answer_text, tenant_id)
+		VALUES (:submit_id, :block_id, :exam_id, :student_id, :item_id, :answer, :answer_objects, :callback, 'pending', NULLIF(:answer_text, ''), NULLIF(:tenant_id, ''))`
+	if _, err := tx.NamedExec(query, rows); err != nil {
+		log.Printf("[submitStudentAnswers] Insert failed for student answers: %v", err)
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Insert failed for student answer")
+	}
+	if err := enqueueTx(tx, STUDENTANSWERSQUEUE, payloads); err != nil {
+		log.Printf("[submitStudentAnswers] Enqueue failed: %v", err)
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Failed to add task to queue")
+	}
 	if err := tx.Commit(); err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Commit failed")
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Commit failed")
 	}
+	sc.kickOutbox()
 
-	go sc.monitorSubmitCallback(submitId, req.Callback, req.ExamID)
-	return c.JSON(fiber.Map{
-		"code":    0,
-		"message": "Submitted successfully",
-	})
+	go sc.monitorSubmitCallback(submitId, req.Callback, req.ExamID, tenantID)
+	return submitId, nil
+}
+
+// blockPending 判断任务对应的作答块是否仍在等待判卷；作答块已被新的提交覆盖时同样返回 false
+func (sc *SubmitExamCase) blockPending(task ExamStudentAnswerTask) (bool, error) {
+	var status string
+	err := sc.db.QueryRow(`SELECT status FROM exam_blocks WHERE block_id = $1 AND submit_id = $2`, task.BlockID, task.SubmitId).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return status == "pending", nil
 }
 
 func (sc *SubmitExamCase) SubmitAnswerWorker() {
@@ -317,89 +543,177 @@ func (sc *SubmitExamCase) SubmitAnswerWorker() {
 			log.Printf("[SubmitAnswerWorker] JSON decode failed: %v", err)
 			continue
 		}
+		if fieldErrors := utils.ValidateStruct(&task); fieldErrors != nil {
+			log.Printf("[SubmitAnswerWorker] Invalid answer task %s: %+v", task.BlockID, fieldErrors)
+			if task.BlockID != "" {
+				sc.failBlock(task, "作答任务不合法，请检查！")
+			}
+			continue
+		}
+		// outbox 至少投递一次，重复的任务在作答块已判完后跳过；申诉与强制重判除外
+		if task.AppealID == 0 && !task.ForceRegrade {
+			pending, err := sc.blockPending(task)
+			if err != nil {
+				log.Printf("[SubmitAnswerWorker] Failed to fetch block status: %v", err)
+			} else if !pending {
+				log.Printf("[SubmitAnswerWorker] Block %s of submission %s is no longer pending, skip", task.BlockID, task.SubmitId)
+				continue
+			}
+		}
 		log.Printf("[SubmitAnswerWorker] Processing answer for block: %s, exam: %s, student: %s", task.BlockID, task.ExamID, task.StudentID)
+		// 交给模型前再次校验作答图片地址，防止 DNS 在入队后被改指向内网
+		if err := sc.validateAnswerURLs(ctx, task); err != nil {
+			log.Printf("[SubmitAnswerWorker] Answer url rejected by url policy: %v", err)
+			sc.failBlock(task, "作答图片地址不合法："+err.Error())
+			continue
+		}
+		// 题目仍在预处理时暂存作答，就绪后自动重新入队
+		itemStatus, itemError, err := sc.itemPreparationStatus(task.ItemID)
+		if err != nil {
+			log.Printf("[SubmitAnswerWorker] Failed to fetch item preparation: %v", err)
+		}
+		if itemStatus == ITEMPREPARING {
+			parked, err := sc.parkAnswerTask(task)
+			if err != nil {
+				log.Printf("[SubmitAnswerWorker] Failed to park answer task %s: %v", task.BlockID, err)
+			}
+			if parked {
+				log.Printf("[SubmitAnswerWorker] Item %s is still being prepared, parked block %s", task.ItemID, task.BlockID)
+				continue
+			}
+		}
+		if itemStatus == ITEMFAILED {
+			sc.failBlock(task, "题目预处理失败："+itemError)
+			continue
+		}
 		// 根据 ItemID 获取题目详情
-		query := `SELECT body_result, correct_answer_result FROM exam_items WHERE item_id = $1`
-		var bodyResult, correctAnswerResult string
-		err = sc.db.QueryRow(query, task.ItemID).Scan(&bodyResult, &correctAnswerResult)
+		query := `SELECT body_result, correct_answer_result, correct_answer, full_score, subject, question_type, tolerance, rubric, COALESCE(content_hash, '') FROM exam_items WHERE item_id = $1`
+		var bodyResult, correctAnswerResult, correctAnswer, subject, questionType, itemContentHash string
+		var tolerance float64
+		var rubric grading.Rubric
+		// 旧数据没有 full_score，此时退回使用模型给出的满分
+		var itemFullScore decimal.NullDecimal
+		err = sc.db.QueryRow(query, task.ItemID).Scan(&bodyResult, &correctAnswerResult, &correctAnswer, &itemFullScore, &subject, &questionType, &tolerance, &rubric, &itemContentHash)
 		if err != nil {
-			// todo : 题目不存在，更新状态为 failed
 			log.Printf("[SubmitAnswerWorker] Failed to fetch item details: %v", err)
+			sc.failBlock(task, "题目不存在，请检查！")
 			continue
 		}
-		// 调用判卷方法
-		bizParams := map[string]interface{}{
-			"studentAnswer": task.Answers[0], // todo : 目前数学只处理第一个答案
-			// "body":          bodyResult,
-			"correctAnswer": correctAnswerResult,
+		// 客观题且已有作答文本时本地判分，不调用智能体
+		if grading.QuestionType(questionType).IsObjective() && task.AnswerText != "" && itemFullScore.Valid {
+			if sc.gradeObjectiveBlock(task, grading.QuestionType(questionType), correctAnswer, itemFullScore.Decimal, tolerance) {
+				continue
+			}
+		}
+		// 按学科选择判卷智能体，申诉重判可以指定其他智能体或流水线
+		profile := sc.registry.Resolve(subject, questionType)
+		if task.Pipeline != "" {
+			profile.Pipeline = task.Pipeline
 		}
-		// 批卷子
-		taskResultText := ""
-		isSuccess := true
-		taskResult, err := utils.RetryAgentRequest(EXAMPAPERSMATHAPPID, bizParams, 3)
+		// 指定的智能体替换所有引用判卷配置的阶段。未配置 single_call 智能体且按模式选择流水线时
+		// 不填 SingleCallAppID，以免把 two_step 的判卷切换为 single_call
+		if task.AppID != "" {
+			profile.AppID = task.AppID
+			if profile.SingleCallAppID != "" || profile.Pipeline != "" {
+				profile.SingleCallAppID = task.AppID
+			}
+		}
+		imageMode := profile.ImageMode
+		if imageMode == "" {
+			imageMode = grading.DefaultImageMode()
+		}
+		// 组织作答图片，多页作答全部参与判卷；只有作答文本时直接交给智能体判文本
+		answerImages := grading.AnswerImages{Params: map[string]interface{}{}}
+		if len(task.Answers) > 0 {
+			sources, fetch, known, err := sc.answerImageSources(ctx, task)
+			if err == nil {
+				answerImages, err = grading.PrepareAnswerImages(ctx, imageMode, sources, grading.MaxAnswerImages(), fetch, known)
+			}
+			if err != nil {
+				log.Printf("[SubmitAnswerWorker] Failed to prepare answer images: %v", err)
+				sc.failBlock(task, "作答图片处理失败，请检查！")
+				continue
+			}
+			answerImages.Considered = originalAnswerURLs(task, sources, answerImages.Considered)
+		}
+		// 流水线可引用的任务变量
+		vars := answerImages.Params
+		vars["studentAnswerText"] = task.AnswerText
+		vars["correctAnswer"] = correctAnswerResult
+		vars["body"] = bodyResult
+		vars["subject"] = subject
+		vars["questionType"] = questionType
+		vars["examId"] = task.ExamID
+		vars["itemId"] = task.ItemID
+		vars["blockId"] = task.BlockID
+		vars["studentId"] = task.StudentID
+		if itemFullScore.Valid {
+			vars["fullScore"] = itemFullScore.Decimal.String()
+		}
+		if !rubric.IsEmpty() {
+			rubricJSON, _ := json.Marshal(rubric)
+			vars["rubricText"] = rubric.PromptText()
+			vars["rubricJSON"] = string(rubricJSON)
+		}
+		// 存在 prompt 模板时替换判卷配置中的 prompt，并记录使用的版本
+		var promptTemplateID, promptVersion sql.NullInt64
+		tmpl, err := sc.selectPromptTemplate(task.ExamID, subject, task.PromptVersion)
 		if err != nil {
-			log.Printf("[SubmitAnswerWorker] AgentRequest error: %v", err)
-			isSuccess = false
-			taskResultText = "批卷失败，请检查！"
-		} else {
-			log.Printf("Process successful!")
-			taskResultText = taskResult.Text
-		}
-		// 请求百炼智能体 分析分数
-		scoreRequestRetryCount := 3
-		//scoreRes, err := utils.RetryAgentRequest(HANDLESCOREAPPID, map[string]interface{}{
-		//	"res": taskResult.Text,
-		//}, 3)
-		//
-		//if err != nil {
-		//	log.Printf("[SubmitAnswerWorker] AgentRequest for score error: %v", err)
-		//	continue
-		//}
-		//var scoreResult struct {
-		//	FullScore string `json:"full_score"`
-		//	Score     string `json:"score"`
-		//}
-		//err = json.Unmarshal([]byte(scoreRes.Text), &scoreResult)
-		//if err != nil {
-		//	log.Printf("[SubmitAnswerWorker] JSON unmarshal for score error: %v", err)
-		//	continue
-		//}
-
-		var scoreResult struct {
-			FullScore string `json:"full_score"`
-			Score     string `json:"score"`
+			log.Printf("[SubmitAnswerWorker] Failed to select prompt template: %v", err)
 		}
-
-		scoreSuccess := false
-		if isSuccess {
-			// 仅当判卷成功，才尝试打分
-			for i := 0; i < scoreRequestRetryCount; i++ {
-				scoreRes, err := utils.RetryAgentRequest(HANDLESCOREAPPID, map[string]interface{}{
-					"res": taskResultText,
-				}, 3)
-				if err != nil {
-					log.Printf("[SubmitAnswerWorker] AgentRequest for score error (attempt %d/%d): %v", i+1, scoreRequestRetryCount, err)
-					continue
-				}
-				err = json.Unmarshal([]byte(scoreRes.Text), &scoreResult)
-				if err != nil {
-					log.Printf("[SubmitAnswerWorker] JSON unmarshal for score error (attempt %d/%d): %v", i+1, scoreRequestRetryCount, err)
-					continue
-				}
-				scoreSuccess = true
-				break
+		if tmpl != nil {
+			if prompt, err := tmpl.Render(vars); err != nil {
+				log.Printf("[SubmitAnswerWorker] Falling back to profile prompt: %v", err)
+			} else {
+				profile.Prompt = prompt
+				promptTemplateID = sql.NullInt64{Int64: tmpl.ID, Valid: true}
+				promptVersion = sql.NullInt64{Int64: int64(tmpl.Version), Valid: true}
 			}
+		}
+		// 同一份作答在相同题目版本、智能体与 prompt 下已判过时直接复用结果
+		gradingKey := sc.answerGradingKey(task, answerImages, itemContentHash, map[string]interface{}{
+			"full_score":    itemFullScore,
+			"question_type": questionType,
+			"tolerance":     tolerance,
+			"rubric":        rubric,
+		}, profile)
+		if gradingKey != "" && !task.ForceRegrade && answerImages.Omitted == 0 && sc.reuseGradedBlock(ctx, task, answerImages, gradingKey) {
+			log.Printf("[SubmitAnswerWorker] Reused an earlier grading result for block %s", task.BlockID)
+			sc.finishBlock(task, nil)
+			continue
+		}
+		// 批卷子
+		graded := sc.gradeWithAgents(ctx, task.BlockID, profile, vars)
+		taskResultText := graded.resultText
+		isSuccess := graded.success
 
-			if !scoreSuccess {
-				log.Printf("[SubmitAnswerWorker] Score evaluation failed after retries.")
-				isSuccess = false
-				scoreResult.FullScore = "0"
-				scoreResult.Score = "0"
+		// 打分失败时 score / full_score 保持 NULL，表示未评分，而不是 0 分
+		var score, fullScore, modelFullScore decimal.NullDecimal
+		fullScoreMismatch := false
+		var breakdown grading.Breakdown
+		var final grading.FinalScore
+		if graded.output != nil {
+			// 题目提交的满分 / 评分细则为准，模型给出的满分仅作对照
+			final = grading.Finalize(*graded.output, itemFullScore, rubric)
+			if final.FullScoreMismatch {
+				log.Printf("[SubmitAnswerWorker] Model full score %s differs from item full score %s for block %s", final.ModelFullScore, final.FullScore, task.BlockID)
 			}
-		} else {
-			// 判卷失败就不评分，直接填0分
-			scoreResult.FullScore = "0"
-			scoreResult.Score = "0"
+			score = decimal.NewNullDecimal(final.Score)
+			fullScore = decimal.NewNullDecimal(final.FullScore)
+			modelFullScore = decimal.NewNullDecimal(final.ModelFullScore)
+			fullScoreMismatch = final.FullScoreMismatch
+			breakdown = final.Breakdown
+		}
+
+		// 判卷失败、置信度低、分数异常或有作答图片未参与判卷时进入人工复核队列
+		var reviewStatus sql.NullString
+		reviewReasons := grading.ReviewReasons(isSuccess, graded.output, final, grading.ReviewConfidenceThreshold())
+		if answerImages.Omitted > 0 {
+			log.Printf("[SubmitAnswerWorker] %d answer images of block %s were not graded", answerImages.Omitted, task.BlockID)
+			reviewReasons = append(reviewReasons, grading.ReviewReasonPartialAnswer)
+		}
+		if len(reviewReasons) > 0 {
+			reviewStatus = sql.NullString{String: "pending", Valid: true}
 		}
 
 		var status string
@@ -410,12 +724,41 @@ func (sc *SubmitExamCase) SubmitAnswerWorker() {
 		}
 
 		// update db
-		updateQuery := `UPDATE exam_blocks SET status = $1, score = $2, full_score = $3, result = $4 WHERE submit_id = $5 AND block_id = $6`
-		_, err = sc.db.Exec(updateQuery, status, scoreResult.Score, scoreResult.FullScore, taskResultText, task.SubmitId, task.BlockID)
+		updateQuery := `
+		UPDATE exam_blocks SET
+			status = $1,
+			score = $2,
+			full_score = $3,
+			result = $4,
+			model_full_score = $5,
+			full_score_mismatch = $6,
+			graded_answers = $7,
+			grader = 'llm',
+			score_breakdown = $8,
+			grader_output = $9,
+			confidence = $10,
+			pipeline_mode = $11,
+			prompt_template_id = $12,
+			prompt_version = $13,
+			image_hashes = $14,
+			grading_key = NULLIF($15, ''),
+			cache_hit = FALSE,
+			cache_source_block_id = NULL,
+			review_status = $16,
+			review_reasons = $17,
+			review_claimed_by = NULL,
+			review_claimed_at = NULL
+		WHERE submit_id = $18 AND block_id = $19
+`
+		_, err = sc.db.Exec(updateQuery, status, score, fullScore, taskResultText, modelFullScore, fullScoreMismatch, pq.Array(answerImages.Considered),
+			breakdown, graded.output, graded.output.ConfidenceValue(), graded.pipeline, promptTemplateID, promptVersion,
+			pq.Array(answerImages.Hashes), gradingKey, reviewStatus, pq.Array(reviewReasons), task.SubmitId, task.BlockID)
 		if err != nil {
 			log.Printf("[SubmitAnswerWorker] Failed to update exam block: %v", err)
+			sc.failBlock(task, "判卷结果保存失败，请检查！")
 			continue
 		}
+		sc.finishBlock(task, &graded)
 
 		//submitKey := SUBMITIDANSWERSUB + task.SubmitId
 		//initialCountKey := fmt.Sprintf("initial_count:%s", task.SubmitId)
@@ -448,17 +791,8 @@ func (sc *SubmitExamCase) SubmitAnswerWorker() {
 		//		if err != nil {
 		//			log.Printf("[prepareResultList] Failed to marshal block: %v", err)
 		//		}
-		//		var resultList []string
-		//		for _, block := range examBlocksList {
-		//			jsonBytes, err := json.Marshal(block)
-		//			if err != nil {
-		//				log.Printf("[prepareResultList] Failed to marshal block: %v", err)
-		//				continue
-		//			}
-		//			resultList = append(resultList, string(jsonBytes))
-		//		}
 		//
-		//		sc.notifyCallback(task, resultList)
+		//		sc.notifyCallback(task, examBlocksList)
 		//
 		//		sc.redisClient.Del(context.Background(), SUBMITIDANSWERSUB+task.SubmitId)
 		//		sc.redisClient.Del(context.Background(), lockKey)
@@ -468,6 +802,7 @@ func (sc *SubmitExamCase) SubmitAnswerWorker() {
 }
 
 type CallbackPayload struct {
+	Event         string          `json:"event,omitempty"` // 为空表示首次判卷完成，result_updated 表示结果被修改
 	ExamID        string          `json:"exam_id"`
 	StudentResult []StudentResult `json:"student_result"`
 }
@@ -481,43 +816,43 @@ type StudentResult struct {
 }
 
 type ResultDetail struct {
-	OverAllFeedBack string `json:"overall_feedback"`
-	Score           string `json:"score"`
-	MaxScore        string `json:"max_score"`
-	Time            string `json:"time"`
+	OverAllFeedBack   string              `json:"overall_feedback"`
+	Score             decimal.NullDecimal `json:"score"`
+	MaxScore          decimal.NullDecimal `json:"max_score"`
+	FullScoreMismatch bool                `json:"full_score_mismatch"`
+	GradedAnswers     []string            `json:"graded_answers"`
+	ScoreBreakdown    grading.Breakdown   `json:"score_breakdown"`
+	CacheHit          bool                `json:"cache_hit"`
+	Time              string              `json:"time"`
 }
 
-func (sc *SubmitExamCase) notifyCallback(task ExamStudentAnswerTask, resultList []string) {
-	var studentResults []StudentResult
-	for _, res := range resultList {
-		var resMap map[string]interface{}
-		err := json.Unmarshal([]byte(res), &resMap)
-		if err != nil {
-			log.Printf("[notifyCallback] JSON unmarshal error: %v", err)
-			continue
-		}
-		studentId, _ := resMap["student_id"].(string)
-		itemId, _ := resMap["item_id"].(string)
-		blockId, _ := resMap["block_id"].(string)
-		score, _ := resMap["score"].(string)
-		fullScore, _ := resMap["full_score"].(string)
-		result, _ := resMap["result"].(string)
-		status, _ := resMap["status"].(string)
+func (sc *SubmitExamCase) notifyCallback(task ExamStudentAnswerTask, blocks []ExamBlockResponse) {
+	sc.notifyCallbackEvent(task, blocks, "")
+}
 
+// notifyCallbackEvent 向回调地址推送作答结果，event 标识推送原因
+func (sc *SubmitExamCase) notifyCallbackEvent(task ExamStudentAnswerTask, blocks []ExamBlockResponse, event string) {
+	var studentResults []StudentResult
+	for _, block := range blocks {
 		studentResults = append(studentResults, StudentResult{
-			StudentID: studentId,
-			ItemID:    itemId,
-			BlockID:   blockId,
-			Status:    status,
+			StudentID: block.StudentID,
+			ItemID:    block.ItemID,
+			BlockID:   block.BlockID,
+			Status:    block.Status,
 			Result: ResultDetail{
-				Score:           score,
-				MaxScore:        fullScore,
-				OverAllFeedBack: result,
-				Time:            time.Now().Format(time.RFC3339), // 使用当前时间作为时间戳
+				Score:             block.Score,
+				MaxScore:          block.FullScore,
+				FullScoreMismatch: block.FullScoreMismatch,
+				GradedAnswers:     block.GradedAnswers,
+				ScoreBreakdown:    block.ScoreBreakdown,
+				CacheHit:          block.CacheHit,
+				OverAllFeedBack:   block.Result,
+				Time:              time.Now().Format(time.RFC3339), // 使用当前时间作为时间戳
 			},
 		})
 	}
 	payload := CallbackPayload{
+		Event:         event,
 		ExamID:        task.ExamID,
 		StudentResult: studentResults,
 	}
@@ -527,8 +862,8 @@ func (sc *SubmitExamCase) notifyCallback(task ExamStudentAnswerTask, resultList
 		return
 	}
 	log.Printf("callback answer" + string(payloadJson))
-	// 发送 HTTP POST 请求
-	resp, err := http.Post(task.Callback, "application/json", bytes.NewReader(payloadJson))
+	// 发送 HTTP POST 请求，投递前重新套用 URL 策略
+	resp, err := sc.urlPolicy.Post(context.Background(), task.TenantID, task.Callback, "application/json", payloadJson)
 	if err != nil {
 		log.Printf("[notifyCallback] POST request error: %v", err)
 		return
@@ -540,33 +875,26 @@ func (sc *SubmitExamCase) notifyCallback(task ExamStudentAnswerTask, resultList
 	}
 }
 
-func (sc *SubmitExamCase) notifyExamCallback(task ExamItemTask) {
-	payload := map[string]interface{}{
-		"card_id": task.ExamID,
-		"result":  "Done",
-	}
-	payloadJson, _ := json.Marshal(payload)
-	resp, err := http.Post(task.CallBack, "application/json", bytes.NewReader(payloadJson))
-	if err != nil {
-		log.Printf("[notifyExamCallback] POST request error: %v", err)
-		return
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		log.Printf("[notifyExamCallback] Callback returned non-200 status: %d", resp.StatusCode)
-	}
+func (sc *SubmitExamCase) listExamBlocksBySubmitId(submitId string) ([]ExamBlockResponse, error) {
+	return sc.listExamBlocks("submit_id = $1", submitId)
 }
 
-func (sc *SubmitExamCase) listExamBlocksBySubmitId(submitId string) ([]ExamBlockResponse, error) {
+// listExamBlocks 按条件查询作答块结果，condition 中的参数占位符从 $1 开始
+func (sc *SubmitExamCase) listExamBlocks(condition string, args ...interface{}) ([]ExamBlockResponse, error) {
 	query := `SELECT block_id, item_id, student_id, 
            COALESCE(result, '处理失败，请检查！') as result, 
-           COALESCE(score, '0') as score, 
-           COALESCE(full_score, '0') as full_score, 
+           score, 
+           full_score, 
+           full_score_mismatch,
+           COALESCE(graded_answers, '{}') as graded_answers,
+           score_breakdown,
+           grader_output,
+           cache_hit,
            status
-           FROM exam_blocks WHERE submit_id = $1
+           FROM exam_blocks WHERE ` + condition + `
            ORDER BY block_id`
 
-	rows, err := sc.db.Query(query, submitId)
+	rows, err := sc.db.Query(query, args...)
 	if err != nil {
 		log.Printf("[listExamBlocksBySubmitId] Query error: %v", err)
 		return nil, err
@@ -583,6 +911,11 @@ func (sc *SubmitExamCase) listExamBlocksBySubmitId(submitId string) ([]ExamBlock
 			&block.Result,
 			&block.Score,
 			&block.FullScore,
+			&block.FullScoreMismatch,
+			pq.Array(&block.GradedAnswers),
+			&block.ScoreBreakdown,
+			&block.GraderOutput,
+			&block.CacheHit,
 			&block.Status,
 		)
 		if err != nil {
@@ -600,7 +933,7 @@ func (sc *SubmitExamCase) listExamBlocksBySubmitId(submitId string) ([]ExamBlock
 	return examBlocks, nil
 }
 
-func (sc *SubmitExamCase) monitorSubmitCallback(submitId, callback, examId string) {
+func (sc *SubmitExamCase) monitorSubmitCallback(submitId, callback, examId, tenantID string) {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
@@ -623,7 +956,7 @@ func (sc *SubmitExamCase) monitorSubmitCallback(submitId, callback, examId strin
 			// 如果没有pending的任务了，说明都完成了
 			if pendingCount == 0 {
 				log.Printf("[Monitor] All tasks completed for %s, executing callback", submitId)
-				sc.executeCallback(submitId, callback, examId)
+				sc.executeCallback(submitId, callback, examId, tenantID)
 				log.Printf("[Monitor] Callback completed for %s, goroutine exiting", submitId)
 				return // goroutine自杀
 			}
@@ -631,7 +964,7 @@ func (sc *SubmitExamCase) monitorSubmitCallback(submitId, callback, examId strin
 	}
 }
 
-func (sc *SubmitExamCase) executeCallback(submitId, callback, examId string) {
+func (sc *SubmitExamCase) executeCallback(submitId, callback, examId, tenantID string) {
 	// 获取这个submitId的所有结果
 	examBlocksList, err := sc.listExamBlocksBySubmitId(submitId)
 	if err != nil {
@@ -639,20 +972,125 @@ func (sc *SubmitExamCase) executeCallback(submitId, callback, examId string) {
 		return
 	}
 
-	// 准备结果列表
-	var resultList []string
-	for _, block := range examBlocksList {
-		jsonBytes, _ := json.Marshal(block)
-		resultList = append(resultList, string(jsonBytes))
-	}
-
 	// 构造任务对象用于回调
 	task := ExamStudentAnswerTask{
 		Callback: callback,
 		SubmitId: submitId,
 		ExamID:   examId,
+		TenantID: tenantID,
 	}
 
 	// 执行回调
-	sc.notifyCallback(task, resultList)
+	sc.notifyCallback(task, examBlocksList)
+}
+
+// validateAnswerURLs 校验作答图片的原始地址，已转存 MinIO 的作答不再访问原始地址，无需校验
+func (sc *SubmitExamCase) validateAnswerURLs(ctx context.Context, task ExamStudentAnswerTask) error {
+	if len(task.AnswerObjects) > 0 {
+		return nil
+	}
+	for _, answerURL := range task.Answers {
+		if err := sc.urlPolicy.Validate(ctx, task.TenantID, answerURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// failBlock 将作答块标记为失败并记录原因
+func (sc *SubmitExamCase) failBlock(task ExamStudentAnswerTask, reason string) {
+	updateQuery := `
+		UPDATE exam_blocks SET
+			status = 'failed',
+			result = $1,
+			review_status = 'pending',
+			review_reasons = ARRAY['failed'],
+			review_claimed_by = NULL,
+			review_claimed_at = NULL
+		WHERE submit_id = $2 AND block_id = $3
+`
+	if _, err := sc.db.Exec(updateQuery, reason, task.SubmitId, task.BlockID); err != nil {
+		log.Printf("[failBlock] Failed to update exam block %s: %v", task.BlockID, err)
+		return
+	}
+	sc.finishBlock(task, nil)
+}
+
+// itemSubject 返回题目的学科，题目未指定时使用试卷学科
+func itemSubject(req SubmitExamRequest, item Item) string {
+	subject := item.Subject
+	if subject == "" {
+		subject = req.Subject
+	}
+	if subject == "" {
+		subject = grading.DefaultSubject
+	}
+	return strings.ToLower(strings.TrimSpace(subject))
+}
+
+// validateItems 校验试卷及题目的学科均已在判卷配置中注册，且评分细则与满分一致
+func (sc *SubmitExamCase) validateItems(req *SubmitExamRequest) []utils.FieldError {
+	var fieldErrors []utils.FieldError
+	reason := "must be one of: " + strings.Join(sc.registry.Subjects(), " ")
+	if !sc.registry.Supports(req.Subject) {
+		fieldErrors = append(fieldErrors, utils.FieldError{Pointer: "/subject", Reason: reason})
+	}
+	for i, item := range req.Items {
+		if !sc.registry.Supports(item.Subject) {
+			fieldErrors = append(fieldErrors, utils.FieldError{Pointer: fmt.Sprintf("/items/%d/subject", i), Reason: reason})
+		}
+		if err := item.Rubric.Check(item.FullScore); err != nil {
+			fieldErrors = append(fieldErrors, utils.FieldError{Pointer: fmt.Sprintf("/items/%d/rubric", i), Reason: err.Error()})
+		}
+	}
+	return fieldErrors
+}
+
+// itemType 返回题目题型，未指定时视为主观题
+func itemType(item Item) string {
+	if item.Type == "" {
+		return string(grading.QuestionTypeOpen)
+	}
+	return item.Type
+}
+
+// gradeObjectiveBlock 本地判分客观题并写回结果。标准答案无法解析时返回 false，由调用方回退到智能体判卷
+func (sc *SubmitExamCase) gradeObjectiveBlock(task ExamStudentAnswerTask, questionType grading.QuestionType, correctAnswer string, fullScore decimal.Decimal, tolerance float64) bool {
+	result, err := grading.GradeObjective(questionType, correctAnswer, task.AnswerText, fullScore, tolerance)
+	if err != nil {
+		log.Printf("[gradeObjectiveBlock] Falling back to agent for block %s: %v", task.BlockID, err)
+		return false
+	}
+	// 清除上次智能体判卷（如申诉重判前）留下的输出、prompt 与复核状态
+	updateQuery := `
+		UPDATE exam_blocks SET
+			status = 'true',
+			score = $1,
+			full_score = $2,
+			result = $3,
+			grader = 'local',
+			model_full_score = NULL,
+			full_score_mismatch = FALSE,
+			score_breakdown = NULL,
+			grader_output = NULL,
+			confidence = NULL,
+			pipeline_mode = NULL,
+			prompt_template_id = NULL,
+			prompt_version = NULL,
+			grading_key = NULL,
+			cache_hit = FALSE,
+			cache_source_block_id = NULL,
+			review_status = NULL,
+			review_reasons = NULL,
+			review_claimed_by = NULL,
+			review_claimed_at = NULL
+		WHERE submit_id = $4 AND block_id = $5
+`
+	if _, err := sc.db.Exec(updateQuery, result.Score, fullScore, result.Feedback, task.SubmitId, task.BlockID); err != nil {
+		log.Printf("[gradeObjectiveBlock] Failed to update exam block: %v", err)
+		sc.failBlock(task, "判卷结果保存失败，请检查！")
+		return true
+	}
+	sc.finishBlock(task, nil)
+	return true
 }
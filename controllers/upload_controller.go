@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"examination-papers/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// uploadMaxBytes 读取 UPLOAD_MAX_BYTES，默认单张作答图片不超过 10MB
+func uploadMaxBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("UPLOAD_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return 10 << 20
+}
+
+// uploadPresignExpiry 读取 UPLOAD_PRESIGN_EXPIRY_MINUTES，默认 15 分钟
+func uploadPresignExpiry() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("UPLOAD_PRESIGN_EXPIRY_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return 15 * time.Minute
+}
+
+// uploadObjectDir 返回租户直传对象所在目录，租户只能引用自己目录下的对象。
+// 目录名为租户 ID 的十六进制编码，不同租户不会落到同一目录
+func uploadObjectDir(tenantID string) string {
+	return utils.UploadObjectPrefix + hex.EncodeToString([]byte(tenantID)) + "/"
+}
+
+// uploadTenantFailure 直传对象按租户隔离，token 中没有租户时拒绝上传
+func uploadTenantFailure(tenantID string) fiber.Map {
+	if tenantID == "" {
+		return fiber.Map{
+			"code":    1,
+			"message": "Uploads require a token with a " + TENANTCLAIM + " claim",
+		}
+	}
+	return nil
+}
+
+func newUploadObjectKey(tenantID string) string {
+	return uploadObjectDir(tenantID) + uuid.NewString()
+}
+
+// UploadedObject 是一张直传的作答图片，Key 可直接填入 answer_list
+type UploadedObject struct {
+	Key         string `json:"key"`
+	Filename    string `json:"filename,omitempty"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+type PresignUploadRequest struct {
+	Count int `json:"count" validate:"omitempty,min=1,max=50"` // 需要的上传地址数量，默认 1
+}
+
+// PresignedUpload 是一个预签名上传地址，客户端 PUT 文件后用 Key 引用
+type PresignedUpload struct {
+	Key       string    `json:"key"`
+	URL       string    `json:"url"`
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// objectStorageFailure 未配置 MinIO 时返回错误响应内容
+func (sc *SubmitExamCase) objectStorageFailure() fiber.Map {
+	if sc.minioClient == nil {
+		return fiber.Map{
+			"code":    1,
+			"message": "Object storage is not configured",
+		}
+	}
+	return nil
+}
+
+// UploadAnswerImagesController 以 multipart/form-data 上传作答图片（字段名 files，可多个），返回对象 key
+func (sc *SubmitExamCase) UploadAnswerImagesController(c *fiber.Ctx) error {
+	if failure := sc.objectStorageFailure(); failure != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(failure)
+	}
+	tenantID := requestTenant(c)
+	if failure := uploadTenantFailure(tenantID); failure != nil {
+		return c.Status(fiber.StatusForbidden).JSON(failure)
+	}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code":    1,
+			"message": "Invalid multipart form",
+		})
+	}
+	files := append(form.File["files"], form.File["file"]...)
+	if len(files) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code":    1,
+			"message": "No files uploaded",
+		})
+	}
+	maxBytes := uploadMaxBytes()
+	uploaded := make([]UploadedObject, 0, len(files))
+	for _, header := range files {
+		if header.Size > maxBytes {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"code":    1,
+				"message": fmt.Sprintf("File %s exceeds %d bytes", header.Filename, maxBytes),
+			})
+		}
+		file, err := header.Open()
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to read upload")
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+		file.Close()
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to read upload")
+		}
+		contentType, err := checkAnswerImage(data, maxBytes)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"code":    1,
+				"message": fmt.Sprintf("File %s: %v", header.Filename, err),
+			})
+		}
+		key := newUploadObjectKey(tenantID)
+		if err := sc.minioClient.Put(context.Background(), key, data, contentType); err != nil {
+			log.Printf("[UploadAnswerImagesController] %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "Storage error")
+		}
+		uploaded = append(uploaded, UploadedObject{Key: key, Filename: header.Filename, Size: int64(len(data)), ContentType: contentType})
+	}
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"data": uploaded,
+	})
+}
+
+// PresignUploadController 签发预签名 PUT 地址，扫描仪和移动端可直接上传到 MinIO
+func (sc *SubmitExamCase) PresignUploadController(c *fiber.Ctx) error {
+	if failure := sc.objectStorageFailure(); failure != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(failure)
+	}
+	tenantID := requestTenant(c)
+	if failure := uploadTenantFailure(tenantID); failure != nil {
+		return c.Status(fiber.StatusForbidden).JSON(failure)
+	}
+	var req PresignUploadRequest
+	if len(c.Body()) > 0 {
+		if failure := bindAndValidate(c, &req); failure != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(failure)
+		}
+	}
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	expiry := uploadPresignExpiry()
+	uploads := make([]PresignedUpload, 0, req.Count)
+	for i := 0; i < req.Count; i++ {
+		key := newUploadObjectKey(tenantID)
+		url, err := sc.minioClient.PresignedPut(context.Background(), key, expiry)
+		if err != nil {
+			log.Printf("[PresignUploadController] %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "Storage error")
+		}
+		uploads = append(uploads, PresignedUpload{Key: key, URL: url, Method: http.MethodPut, ExpiresAt: time.Now().Add(expiry)})
+	}
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"data": uploads,
+	})
+}
+
+// checkAnswerImage 校验作答图片的大小与类型，返回识别出的 Content-Type
+func checkAnswerImage(data []byte, maxBytes int64) (string, error) {
+	if len(data) == 0 {
+		return "", errors.New("file is empty")
+	}
+	if int64(len(data)) > maxBytes {
+		return "", fmt.Errorf("file exceeds %d bytes", maxBytes)
+	}
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", fmt.Errorf("unsupported content type %s", contentType)
+	}
+	return contentType, nil
+}
+
+// validateAnswerRef 提交前校验作答图片：URL 走 URL 策略，对象 key 需属于当前租户
+func (sc *SubmitExamCase) validateAnswerRef(ctx context.Context, tenantID, ref string) error {
+	if !utils.IsUploadObjectKey(ref) {
+		return sc.urlPolicy.Validate(ctx, tenantID, ref)
+	}
+	if sc.minioClient == nil {
+		return errors.New("object storage is not configured")
+	}
+	if tenantID == "" {
+		return errors.New("object keys require a tenant")
+	}
+	if !strings.HasPrefix(ref, uploadObjectDir(tenantID)) {
+		return errors.New("object key belongs to another tenant")
+	}
+	return nil
+}
+
+// readUploadedObject 读取直传的作答图片并校验大小与类型
+func (sc *SubmitExamCase) readUploadedObject(ctx context.Context, key string) ([]byte, error) {
+	maxBytes := uploadMaxBytes()
+	size, err := sc.minioClient.Size(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxBytes {
+		return nil, fmt.Errorf("object %s exceeds %d bytes", key, maxBytes)
+	}
+	data, err := sc.minioClient.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkAnswerImage(data, maxBytes); err != nil {
+		return nil, fmt.Errorf("object %s: %w", key, err)
+	}
+	return data, nil
+}
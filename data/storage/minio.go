@@ -1,11 +1,19 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"io"
 	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type MinioConfig struct {
@@ -14,21 +22,44 @@ type MinioConfig struct {
 	SecretAccessKey string
 	UseSSL          bool
 	BucketName      string
+	Region          string
+	// 预签名地址交给外部（判卷智能体、扫描仪）访问，需使用外部可达的地址签名；为空时使用 Endpoint
+	PublicEndpoint string
+	PublicUseSSL   bool
 }
 
 type MinioClient struct {
 	Client     *minio.Client
 	BucketName string
+	// presigner 按外部地址签名，只在本地计算签名，不发起请求
+	presigner *minio.Client
 }
 
 func NewMinioClient(cfg MinioConfig) (*MinioClient, error) {
 	client, err := minio.New(cfg.Endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
 		Secure: cfg.UseSSL,
+		Region: cfg.Region,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("init minio client fail : %w", err)
 	}
+	presigner := client
+	if cfg.PublicEndpoint != "" {
+		// 指定 Region 后签名时不再向外部地址查询桶所在区域
+		region := cfg.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		presigner, err = minio.New(cfg.PublicEndpoint, &minio.Options{
+			Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+			Secure: cfg.PublicUseSSL,
+			Region: region,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("init minio presign client fail : %w", err)
+		}
+	}
 
 	// 检查 Bucket 是否存在
 	ctx := context.Background()
@@ -47,5 +78,155 @@ func NewMinioClient(cfg MinioConfig) (*MinioClient, error) {
 	return &MinioClient{
 		Client:     client,
 		BucketName: cfg.BucketName,
+		presigner:  presigner,
 	}, nil
 }
+
+// MinioConfigFromEnv 读取 MINIO_ENDPOINT、MINIO_ACCESS_KEY、MINIO_SECRET_KEY、MINIO_USE_SSL、MINIO_BUCKET、MINIO_REGION，
+// 以及预签名使用的 MINIO_PUBLIC_ENDPOINT、MINIO_PUBLIC_USE_SSL（默认同 MINIO_USE_SSL）。未配置 MINIO_ENDPOINT 时返回 false
+func MinioConfigFromEnv() (MinioConfig, bool) {
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		return MinioConfig{}, false
+	}
+	bucket := os.Getenv("MINIO_BUCKET")
+	if bucket == "" {
+		bucket = "examination-papers"
+	}
+	useSSL, _ := strconv.ParseBool(os.Getenv("MINIO_USE_SSL"))
+	publicUseSSL, err := strconv.ParseBool(os.Getenv("MINIO_PUBLIC_USE_SSL"))
+	if err != nil {
+		publicUseSSL = useSSL
+	}
+	return MinioConfig{
+		Endpoint:        endpoint,
+		AccessKeyID:     os.Getenv("MINIO_ACCESS_KEY"),
+		SecretAccessKey: os.Getenv("MINIO_SECRET_KEY"),
+		UseSSL:          useSSL,
+		BucketName:      bucket,
+		Region:          os.Getenv("MINIO_REGION"),
+		PublicEndpoint:  os.Getenv("MINIO_PUBLIC_ENDPOINT"),
+		PublicUseSSL:    publicUseSSL,
+	}, true
+}
+
+// PutIfAbsent 写入对象，同名对象已存在时跳过。用于内容寻址的对象，同一个 key 的内容总是相同的
+func (m *MinioClient) PutIfAbsent(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := m.Client.StatObject(ctx, m.BucketName, key, minio.StatObjectOptions{})
+	if err == nil {
+		return nil
+	}
+	if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return fmt.Errorf("stat object %s: %w", key, err)
+	}
+	_, err = m.Client.PutObject(ctx, m.BucketName, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("put object %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get 读取对象内容
+func (m *MinioClient) Get(ctx context.Context, key string) ([]byte, error) {
+	object, err := m.Client.GetObject(ctx, m.BucketName, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get object %s: %w", key, err)
+	}
+	defer object.Close()
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("read object %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// PresignedGet 生成对象的临时下载地址，使用外部可达的地址
+func (m *MinioClient) PresignedGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := m.presigner.PresignedGetObject(ctx, m.BucketName, key, expiry, url.Values{})
+	if err != nil {
+		return "", fmt.Errorf("presign object %s: %w", key, err)
+	}
+	return u.String(), nil
+}
+
+// Put 写入对象，覆盖同名对象
+func (m *MinioClient) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := m.Client.PutObject(ctx, m.BucketName, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("put object %s: %w", key, err)
+	}
+	return nil
+}
+
+// Copy 在桶内复制对象，不经过本地
+func (m *MinioClient) Copy(ctx context.Context, srcKey, dstKey string) error {
+	_, err := m.Client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: m.BucketName, Object: dstKey},
+		minio.CopySrcOptions{Bucket: m.BucketName, Object: srcKey})
+	if err != nil {
+		return fmt.Errorf("copy object %s to %s: %w", srcKey, dstKey, err)
+	}
+	return nil
+}
+
+// RemovePrefix 删除 prefix 下的全部对象
+func (m *MinioClient) RemovePrefix(ctx context.Context, prefix string) error {
+	objects := m.Client.ListObjects(ctx, m.BucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
+	for result := range m.Client.RemoveObjects(ctx, m.BucketName, objects, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil {
+			return fmt.Errorf("remove object %s: %w", result.ObjectName, result.Err)
+		}
+	}
+	return nil
+}
+
+// PresignedPut 生成对象的临时上传地址，客户端可直接 PUT 文件内容，使用外部可达的地址
+func (m *MinioClient) PresignedPut(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := m.presigner.PresignedPutObject(ctx, m.BucketName, key, expiry)
+	if err != nil {
+		return "", fmt.Errorf("presign upload %s: %w", key, err)
+	}
+	return u.String(), nil
+}
+
+// Size 返回对象大小
+func (m *MinioClient) Size(ctx context.Context, key string) (int64, error) {
+	info, err := m.Client.StatObject(ctx, m.BucketName, key, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("stat object %s: %w", key, err)
+	}
+	return info.Size, nil
+}
+
+// ExpirePrefix 在桶的生命周期配置中添加或替换本 prefix 的过期规则，prefix 下的对象在 days 天后自动删除，
+// 其他规则保持不变
+func (m *MinioClient) ExpirePrefix(ctx context.Context, prefix string, days int) error {
+	config, err := m.Client.GetBucketLifecycle(ctx, m.BucketName)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code != "NoSuchLifecycleConfiguration" {
+			return fmt.Errorf("get lifecycle for %s: %w", prefix, err)
+		}
+		config = lifecycle.NewConfiguration()
+	}
+	rule := lifecycle.Rule{
+		ID:         "expire-" + strings.TrimSuffix(prefix, "/"),
+		Status:     "Enabled",
+		RuleFilter: lifecycle.Filter{Prefix: prefix},
+		Expiration: lifecycle.Expiration{Days: lifecycle.ExpirationDays(days)},
+	}
+	rules := make([]lifecycle.Rule, 0, len(config.Rules)+1)
+	for _, existing := range config.Rules {
+		if existing.ID != rule.ID {
+			rules = append(rules, existing)
+		}
+	}
+	config.Rules = append(rules, rule)
+	if err := m.Client.SetBucketLifecycle(ctx, m.BucketName, config); err != nil {
+		return fmt.Errorf("set lifecycle for %s: %w", prefix, err)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package grading
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// ContentHash 计算流水线定义、各阶段实际调用的 app id 与输入内容的摘要。流水线、app id 或任一输入变化
+// 都会得到新的摘要，用于复用相同内容的预处理结果。引用判卷配置的阶段由调用方把配置中的 app id 放入 content
+func ContentHash(pipeline Pipeline, content map[string]interface{}) string {
+	h := sha256.New()
+	// 流水线中只记录环境变量名，换了环境变量的取值也要得到新的摘要
+	apps := map[string]string{}
+	for _, stage := range pipeline.Stages {
+		if stage.AppRef == "" {
+			apps[stage.Name] = stage.resolveAppID(Profile{})
+		}
+	}
+	// map 按键排序序列化，结果稳定
+	definition, _ := json.Marshal(pipeline)
+	appIDs, _ := json.Marshal(apps)
+	values, _ := json.Marshal(content)
+	h.Write(definition)
+	h.Write([]byte{0})
+	h.Write(appIDs)
+	h.Write([]byte{0})
+	h.Write(values)
+	return hex.EncodeToString(h.Sum(nil))
+}
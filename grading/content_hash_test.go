@@ -0,0 +1,47 @@
+package grading
+
+import "testing"
+
+func TestContentHash(t *testing.T) {
+	p := builtinPipelines[0]
+	a := ContentHash(p, map[string]interface{}{"body": "1+1=?", "answer": "2"})
+	if a != ContentHash(p, map[string]interface{}{"answer": "2", "body": "1+1=?"}) {
+		t.Error("hash should not depend on key order")
+	}
+	if a == ContentHash(p, map[string]interface{}{"body": "1+1=?", "answer": "3"}) {
+		t.Error("hash should change with content")
+	}
+	changed := p
+	changed.Stages = append([]Stage{}, p.Stages...)
+	changed.Stages[0].Retries++
+	if a == ContentHash(changed, map[string]interface{}{"body": "1+1=?", "answer": "2"}) {
+		t.Error("hash should change with the pipeline definition")
+	}
+}
+
+func TestContentHashResolvedAppID(t *testing.T) {
+	p := builtinPipelines[0]
+	content := map[string]interface{}{"body": "1+1=?", "answer": "2"}
+	t.Setenv("HANDLE_ANSWER_APPID", "answer-app-v1")
+	a := ContentHash(p, content)
+	t.Setenv("HANDLE_ANSWER_APPID", "answer-app-v2")
+	if a == ContentHash(p, content) {
+		t.Error("hash should change with the app id the environment variable resolves to")
+	}
+}
+
+func TestContentHashScoreAppID(t *testing.T) {
+	var p Pipeline
+	for _, builtin := range builtinPipelines {
+		if builtin.Name == string(PipelineModeTwoStep) {
+			p = builtin
+		}
+	}
+	inputs := map[string]interface{}{"item": "h", "app_id": "grade-app"}
+	t.Setenv("HANDLE_SCORE_APPID", "score-app-v1")
+	a := ContentHash(p, inputs)
+	t.Setenv("HANDLE_SCORE_APPID", "score-app-v2")
+	if a == ContentHash(p, inputs) {
+		t.Error("grading key should change with the score stage app id")
+	}
+}
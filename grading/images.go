@@ -0,0 +1,132 @@
+package grading
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"examination-papers/utils"
+)
+
+// ImageMode 决定多页作答图片如何交给判卷智能体
+type ImageMode string
+
+const (
+	// ImageModeMulti 直接把全部图片地址传给支持多图输入的智能体
+	ImageModeMulti ImageMode = "multi"
+	// ImageModeStitch 下载全部图片纵向拼接成一张，以 data URL 传给只接受单图的智能体
+	ImageModeStitch ImageMode = "stitch"
+)
+
+// DefaultImageMode 读取 GRADING_IMAGE_MODE，默认 multi
+func DefaultImageMode() ImageMode {
+	if ImageMode(os.Getenv("GRADING_IMAGE_MODE")) == ImageModeStitch {
+		return ImageModeStitch
+	}
+	return ImageModeMulti
+}
+
+// MaxAnswerImages 读取 GRADING_MAX_ANSWER_IMAGES，默认最多处理 6 张作答图片
+func MaxAnswerImages() int {
+	if v, err := strconv.Atoi(os.Getenv("GRADING_MAX_ANSWER_IMAGES")); err == nil && v > 0 {
+		return v
+	}
+	return 6
+}
+
+// FetchFunc 下载一张作答图片
+type FetchFunc func(ctx context.Context, url string) ([]byte, error)
+
+// AnswerImages 是交给判卷智能体的作答图片参数，以及实际参与判卷的图片列表
+type AnswerImages struct {
+	Params     map[string]interface{}
+	Considered []string
+	Hashes     []string // 参与判卷图片内容的 sha256，有图片未能下载时为空
+	Omitted    int      // 提交了但未参与判卷的图片数，大于 0 时作答需人工复核
+}
+
+// PrepareAnswerImages 按 mode 组织作答图片；超出 maxImages 或下载失败的图片不会参与判卷，计入 Omitted。
+// known 为已知内容摘要的图片地址（如按内容寻址存储的对象），计算摘要时不再下载
+func PrepareAnswerImages(ctx context.Context, mode ImageMode, urls []string, maxImages int, fetch FetchFunc, known map[string]string) (AnswerImages, error) {
+	if len(urls) == 0 {
+		return AnswerImages{}, errors.New("no answer images")
+	}
+	submitted := len(urls)
+	if len(urls) > maxImages {
+		log.Printf("[PrepareAnswerImages] %d answer images exceed limit %d, extra pages are ignored", len(urls), maxImages)
+		urls = urls[:maxImages]
+	}
+
+	if mode != ImageModeStitch || len(urls) == 1 {
+		return AnswerImages{
+			Params: map[string]interface{}{
+				"studentAnswer":  urls[0],
+				"studentAnswers": urls,
+			},
+			Considered: urls,
+			Hashes:     hashImages(ctx, urls, fetch, known),
+			Omitted:    submitted - len(urls),
+		}, nil
+	}
+
+	var pages [][]byte
+	var considered, hashes []string
+	for _, url := range urls {
+		data, err := fetch(ctx, url)
+		if err != nil {
+			log.Printf("[PrepareAnswerImages] Failed to fetch answer image %s: %v", url, err)
+			continue
+		}
+		pages = append(pages, data)
+		considered = append(considered, url)
+		hashes = append(hashes, hashImage(data))
+	}
+	if len(pages) == 0 {
+		return AnswerImages{}, errors.New("failed to fetch any answer image")
+	}
+	stitched, err := utils.StitchImagesVertically(pages)
+	if err != nil {
+		return AnswerImages{}, fmt.Errorf("stitch answer images: %w", err)
+	}
+	return AnswerImages{
+		Params: map[string]interface{}{
+			"studentAnswer": "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(stitched),
+		},
+		Considered: considered,
+		Hashes:     hashes,
+		Omitted:    submitted - len(considered),
+	}, nil
+}
+
+// hashImages 计算图片摘要，用于识别重复提交的作答。已知摘要的图片直接使用，其余下载后计算；
+// 需要下载但 fetch 为空或任一图片下载失败时返回 nil
+func hashImages(ctx context.Context, urls []string, fetch FetchFunc, known map[string]string) []string {
+	hashes := make([]string, 0, len(urls))
+	for _, url := range urls {
+		if hash, ok := known[url]; ok {
+			hashes = append(hashes, hash)
+			continue
+		}
+		if fetch == nil {
+			return nil
+		}
+		data, err := fetch(ctx, url)
+		if err != nil {
+			log.Printf("[PrepareAnswerImages] Failed to hash answer image %s: %v", url, err)
+			return nil
+		}
+		hashes = append(hashes, hashImage(data))
+	}
+	return hashes
+}
+
+func hashImage(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
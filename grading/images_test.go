@@ -0,0 +1,80 @@
+package grading
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func pngPage(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPrepareAnswerImagesMulti(t *testing.T) {
+	urls := []string{"https://a/1.jpg", "https://a/2.jpg", "https://a/3.jpg"}
+	got, err := PrepareAnswerImages(context.Background(), ImageModeMulti, urls, 2, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Considered) != 2 || got.Params["studentAnswer"] != urls[0] || got.Hashes != nil || got.Omitted != 1 {
+		t.Errorf("unexpected result %+v", got)
+	}
+
+	fetch := func(_ context.Context, url string) ([]byte, error) {
+		if url == "https://a/2.jpg" {
+			return nil, errors.New("not found")
+		}
+		return []byte(url), nil
+	}
+	got, _ = PrepareAnswerImages(context.Background(), ImageModeMulti, urls[:1], 2, fetch, nil)
+	if len(got.Hashes) != 1 || got.Hashes[0] != hashImage([]byte(urls[0])) {
+		t.Errorf("unexpected hashes %v", got.Hashes)
+	}
+	got, _ = PrepareAnswerImages(context.Background(), ImageModeMulti, urls, 2, fetch, nil)
+	if got.Hashes != nil {
+		t.Error("hashes should be empty when an image cannot be fetched")
+	}
+	// 已知摘要的图片不再下载
+	known := map[string]string{"https://a/2.jpg": "known-hash"}
+	got, _ = PrepareAnswerImages(context.Background(), ImageModeMulti, urls, 2, fetch, known)
+	if len(got.Hashes) != 2 || got.Hashes[1] != "known-hash" {
+		t.Errorf("unexpected hashes %v", got.Hashes)
+	}
+	got, _ = PrepareAnswerImages(context.Background(), ImageModeMulti, urls[1:2], 2, nil, known)
+	if len(got.Hashes) != 1 {
+		t.Errorf("known hashes should not need fetch, got %v", got.Hashes)
+	}
+}
+
+func TestPrepareAnswerImagesStitch(t *testing.T) {
+	pages := map[string][]byte{
+		"https://a/1.png": pngPage(t, 40, 30),
+		"https://a/3.png": pngPage(t, 20, 10),
+	}
+	fetch := func(_ context.Context, url string) ([]byte, error) {
+		if data, ok := pages[url]; ok {
+			return data, nil
+		}
+		return nil, errors.New("not found")
+	}
+	urls := []string{"https://a/1.png", "https://a/2.png", "https://a/3.png"}
+	got, err := PrepareAnswerImages(context.Background(), ImageModeStitch, urls, 6, fetch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got.Considered, ",") != "https://a/1.png,https://a/3.png" || len(got.Hashes) != 2 || got.Omitted != 1 {
+		t.Errorf("unexpected considered images %v", got.Considered)
+	}
+	if !strings.HasPrefix(got.Params["studentAnswer"].(string), "data:image/jpeg;base64,") {
+		t.Error("stitched answer should be sent as a JPEG data URL")
+	}
+}
@@ -0,0 +1,75 @@
+package grading
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// LayoutBox 页面上的矩形区域，坐标与宽高均为相对页面尺寸的比例（0-1），原点在左上角
+type LayoutBox struct {
+	X      float64 `json:"x" validate:"gte=0,lt=1"`
+	Y      float64 `json:"y" validate:"gte=0,lt=1"`
+	Width  float64 `json:"width" validate:"gt=0,lte=1"`
+	Height float64 `json:"height" validate:"gt=0,lte=1"`
+}
+
+// LayoutRegion 将扫描件某一页上的区域分配给一道题，Box 为空时取整页。
+// 同一道题可以有多个区域（跨页作答），按出现顺序拼成多页作答
+type LayoutRegion struct {
+	ItemID string     `json:"item_id" validate:"required"`
+	Page   int        `json:"page" validate:"required,min=1"`
+	Box    *LayoutBox `json:"box,omitempty"`
+}
+
+// ScanLayout 试卷的答题卡版面，描述扫描件各页 / 区域对应的题目
+type ScanLayout struct {
+	Regions []LayoutRegion `json:"regions" validate:"required,min=1,dive"`
+}
+
+// Check 校验区域不超出页面
+func (l ScanLayout) Check() error {
+	for i, r := range l.Regions {
+		if r.Box == nil {
+			continue
+		}
+		if r.Box.X+r.Box.Width > 1 || r.Box.Y+r.Box.Height > 1 {
+			return fmt.Errorf("region %d of item %s exceeds the page", i, r.ItemID)
+		}
+	}
+	return nil
+}
+
+// Pages 返回版面用到的页数
+func (l ScanLayout) Pages() int {
+	pages := 0
+	for _, r := range l.Regions {
+		if r.Page > pages {
+			pages = r.Page
+		}
+	}
+	return pages
+}
+
+// Items 按首次出现的顺序返回版面中的题目
+func (l ScanLayout) Items() []string {
+	seen := map[string]bool{}
+	var items []string
+	for _, r := range l.Regions {
+		if !seen[r.ItemID] {
+			seen[r.ItemID] = true
+			items = append(items, r.ItemID)
+		}
+	}
+	return items
+}
+
+// Value 实现 driver.Valuer
+func (l ScanLayout) Value() (driver.Value, error) {
+	return json.Marshal(l)
+}
+
+// Scan 实现 sql.Scanner
+func (l *ScanLayout) Scan(src interface{}) error {
+	return scanJSON(src, l)
+}
@@ -0,0 +1,27 @@
+package grading
+
+import "testing"
+
+func TestScanLayout(t *testing.T) {
+	layout := ScanLayout{Regions: []LayoutRegion{
+		{ItemID: "q1", Page: 1, Box: &LayoutBox{X: 0, Y: 0, Width: 1, Height: 0.5}},
+		{ItemID: "q2", Page: 1, Box: &LayoutBox{X: 0, Y: 0.5, Width: 1, Height: 0.5}},
+		{ItemID: "q3", Page: 2},
+		{ItemID: "q2", Page: 3},
+	}}
+	if err := layout.Check(); err != nil {
+		t.Errorf("Check returned error: %v", err)
+	}
+	if layout.Pages() != 3 {
+		t.Errorf("Pages() = %d, want 3", layout.Pages())
+	}
+	items := layout.Items()
+	if len(items) != 3 || items[0] != "q1" || items[1] != "q2" || items[2] != "q3" {
+		t.Errorf("Items() = %v", items)
+	}
+
+	layout.Regions[1].Box.Height = 0.6
+	if err := layout.Check(); err == nil {
+		t.Error("expected error for a region exceeding the page")
+	}
+}
@@ -0,0 +1,248 @@
+package grading
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+// QuestionType 题型
+type QuestionType string
+
+const (
+	QuestionTypeSingleChoice   QuestionType = "single_choice"
+	QuestionTypeMultipleChoice QuestionType = "multiple_choice"
+	QuestionTypeTrueFalse      QuestionType = "true_false"
+	QuestionTypeNumeric        QuestionType = "numeric"
+	QuestionTypeOpen           QuestionType = "open"
+)
+
+var ErrUnparsableAnswer = errors.New("answer cannot be parsed for this question type")
+
+// IsObjective 判断题型是否可以不经过智能体直接本地判分
+func (t QuestionType) IsObjective() bool {
+	switch t {
+	case QuestionTypeSingleChoice, QuestionTypeMultipleChoice, QuestionTypeTrueFalse, QuestionTypeNumeric:
+		return true
+	}
+	return false
+}
+
+// ObjectiveResult 本地判分结果
+type ObjectiveResult struct {
+	Correct  bool
+	Score    decimal.Decimal
+	Feedback string
+}
+
+// GradeObjective 按题型对标准答案和学生作答做归一化比较。
+// 选择题须与标准答案完全一致才得分；学生作答不是明确的选项写法时返回 ErrUnparsableAnswer，交给智能体判卷。
+// 数值题在 tolerance 范围内视为正确
+func GradeObjective(questionType QuestionType, correctAnswer, studentAnswer string, fullScore decimal.Decimal, tolerance float64) (ObjectiveResult, error) {
+	switch questionType {
+	case QuestionTypeSingleChoice, QuestionTypeMultipleChoice:
+		single := questionType == QuestionTypeSingleChoice
+		want, ok := parseOptions(correctAnswer, single)
+		if !ok || (single && len(want) != 1) {
+			return ObjectiveResult{}, fmt.Errorf("%w: correct answer %q", ErrUnparsableAnswer, correctAnswer)
+		}
+		got, ok := parseOptions(studentAnswer, single)
+		if !ok {
+			return ObjectiveResult{}, fmt.Errorf("%w: student answer %q", ErrUnparsableAnswer, studentAnswer)
+		}
+		return verdict(strings.Join(want, "") == strings.Join(got, ""), fullScore, want, got), nil
+
+	case QuestionTypeTrueFalse:
+		want, ok := parseTrueFalse(correctAnswer)
+		if !ok {
+			return ObjectiveResult{}, fmt.Errorf("%w: correct answer %q", ErrUnparsableAnswer, correctAnswer)
+		}
+		got, ok := parseTrueFalse(studentAnswer)
+		return verdict(ok && got == want, fullScore, correctAnswer, studentAnswer), nil
+
+	case QuestionTypeNumeric:
+		want, err := parseQuantity(correctAnswer)
+		if err != nil {
+			return ObjectiveResult{}, fmt.Errorf("%w: correct answer %q", ErrUnparsableAnswer, correctAnswer)
+		}
+		got, err := parseQuantity(studentAnswer)
+		if err != nil {
+			return verdict(false, fullScore, correctAnswer, studentAnswer), nil
+		}
+		return verdict(want.matches(got, tolerance), fullScore, correctAnswer, studentAnswer), nil
+	}
+	return ObjectiveResult{}, fmt.Errorf("question type %q is not objective", questionType)
+}
+
+func verdict(correct bool, fullScore decimal.Decimal, want, got interface{}) ObjectiveResult {
+	format := func(v interface{}) string {
+		if options, ok := v.([]string); ok {
+			return strings.Join(options, "")
+		}
+		return fmt.Sprint(v)
+	}
+	if correct {
+		return ObjectiveResult{Correct: true, Score: fullScore, Feedback: fmt.Sprintf("回答正确：%s", format(got))}
+	}
+	return ObjectiveResult{Score: decimal.Zero, Feedback: fmt.Sprintf("回答错误：标准答案 %s，作答 %s", format(want), format(got))}
+}
+
+// maxOptionLetter 是选项字母的上限，超出的字母（如 "I think A" 中的 I）不视为选项
+const maxOptionLetter = 'H'
+
+// parseOptions 解析选项并去重排序，兼容全角字母、小写。只接受明确的选项写法：
+// 以逗号、顿号或空格分隔的选项字母（"A,C"、"A、C"、"A C"），连写的升序选项（"ACD"）；
+// 单选题另外接受开头的单个选项字母后跟标点或说明（"B."、"B 因为……"）。其他写法返回 false
+func parseOptions(answer string, single bool) ([]string, bool) {
+	s := []rune(strings.ToUpper(strings.TrimSpace(toHalfWidth(answer))))
+	if len(s) == 0 {
+		return nil, false
+	}
+	fields := strings.FieldsFunc(string(s), func(r rune) bool { return r == ',' || r == '、' || unicode.IsSpace(r) })
+	seen := map[string]bool{}
+	var options []string
+	for _, field := range fields {
+		letters, ok := optionRun(field)
+		if !ok {
+			options = nil
+			break
+		}
+		for _, letter := range letters {
+			if !seen[letter] {
+				seen[letter] = true
+				options = append(options, letter)
+			}
+		}
+	}
+	if options == nil && single && isOptionLetter(s[0]) && (len(s) == 1 || !unicode.IsLetter(s[1]) && !unicode.IsDigit(s[1])) {
+		options = []string{string(s[0])}
+	}
+	if options == nil {
+		return nil, false
+	}
+	sort.Strings(options)
+	return options, true
+}
+
+// optionRun 解析单个选项字母或连写的升序选项字母，如 "B"、"ACD"
+func optionRun(field string) ([]string, bool) {
+	var letters []string
+	var last rune
+	for _, r := range field {
+		if !isOptionLetter(r) || r <= last {
+			return nil, false
+		}
+		letters = append(letters, string(r))
+		last = r
+	}
+	return letters, len(letters) > 0
+}
+
+func isOptionLetter(r rune) bool {
+	return r >= 'A' && r <= maxOptionLetter
+}
+
+var trueFalseWords = map[string]bool{
+	"对": true, "√": true, "✓": true, "✔": true, "正确": true, "是": true, "t": true, "true": true, "y": true, "yes": true,
+	"错": false, "×": false, "✗": false, "✘": false, "x": false, "错误": false, "否": false, "f": false, "false": false, "n": false, "no": false,
+}
+
+func parseTrueFalse(answer string) (bool, bool) {
+	v, ok := trueFalseWords[strings.ToLower(strings.TrimSpace(toHalfWidth(answer)))]
+	return v, ok
+}
+
+// quantity 是换算到基本单位后的数值
+type quantity struct {
+	value     float64
+	dimension string // 为空表示无单位
+}
+
+func (q quantity) matches(other quantity, tolerance float64) bool {
+	// 一方没写单位时按同一单位比较数值
+	if q.dimension != "" && other.dimension != "" && q.dimension != other.dimension {
+		return false
+	}
+	if tolerance <= 0 {
+		tolerance = 1e-9 * math.Max(1, math.Abs(q.value))
+	}
+	return math.Abs(q.value-other.value) <= tolerance
+}
+
+type unit struct {
+	dimension string
+	factor    float64
+}
+
+// units 常见单位到基本单位（米、千克、秒、升）的换算
+var units = map[string]unit{
+	"mm": {"length", 0.001}, "毫米": {"length", 0.001},
+	"cm": {"length", 0.01}, "厘米": {"length", 0.01},
+	"dm": {"length", 0.1}, "分米": {"length", 0.1},
+	"m": {"length", 1}, "米": {"length", 1},
+	"km": {"length", 1000}, "千米": {"length", 1000}, "公里": {"length", 1000},
+	"mg": {"mass", 1e-6}, "毫克": {"mass", 1e-6},
+	"g": {"mass", 0.001}, "克": {"mass", 0.001},
+	"kg": {"mass", 1}, "千克": {"mass", 1}, "公斤": {"mass", 1},
+	"t": {"mass", 1000}, "吨": {"mass", 1000},
+	"s": {"time", 1}, "秒": {"time", 1},
+	"min": {"time", 60}, "分钟": {"time", 60},
+	"h": {"time", 3600}, "小时": {"time", 3600},
+	"ml": {"volume", 0.001}, "毫升": {"volume", 0.001},
+	"l": {"volume", 1}, "升": {"volume", 1},
+	"%": {"", 0.01},
+}
+
+var quantityPattern = regexp.MustCompile(`^([-+]?\d+(?:\.\d+)?)(?:\s*/\s*(\d+(?:\.\d+)?))?\s*(\S*)$`)
+
+// parseQuantity 解析 "3.5"、"1/2"、"50%"、"12 cm"、"x=3" 等写法
+func parseQuantity(answer string) (quantity, error) {
+	s := strings.TrimSpace(toHalfWidth(answer))
+	if i := strings.LastIndex(s, "="); i >= 0 {
+		s = strings.TrimSpace(s[i+1:])
+	}
+	s = strings.ReplaceAll(s, ",", "")
+	m := quantityPattern.FindStringSubmatch(s)
+	if m == nil {
+		return quantity{}, fmt.Errorf("%w: %q", ErrUnparsableAnswer, answer)
+	}
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return quantity{}, err
+	}
+	if m[2] != "" {
+		denominator, err := strconv.ParseFloat(m[2], 64)
+		if err != nil || denominator == 0 {
+			return quantity{}, fmt.Errorf("%w: %q", ErrUnparsableAnswer, answer)
+		}
+		value /= denominator
+	}
+	if m[3] == "" {
+		return quantity{value: value}, nil
+	}
+	u, ok := units[strings.ToLower(m[3])]
+	if !ok {
+		return quantity{}, fmt.Errorf("%w: unknown unit %q", ErrUnparsableAnswer, m[3])
+	}
+	return quantity{value: value * u.factor, dimension: u.dimension}, nil
+}
+
+// toHalfWidth 将全角字符转换为半角
+func toHalfWidth(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '　':
+			return ' '
+		case r >= '！' && r <= '～':
+			return r - 0xFEE0
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,82 @@
+package grading
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestGradeObjective(t *testing.T) {
+	full := decimal.NewFromInt(4)
+	cases := []struct {
+		questionType QuestionType
+		correct      string
+		student      string
+		tolerance    float64
+		wantScore    string
+	}{
+		{QuestionTypeSingleChoice, "B", "ｂ", 0, "4"},
+		{QuestionTypeSingleChoice, "B", "AB", 0, "0"},
+		{QuestionTypeMultipleChoice, "ACD", "D、A、C", 0, "4"},
+		{QuestionTypeSingleChoice, "B", "B. 因为两边相等", 0, "4"},
+		{QuestionTypeSingleChoice, "B", "b", 0, "4"},
+		{QuestionTypeMultipleChoice, "ACD", "AC", 0, "0"},
+		{QuestionTypeMultipleChoice, "A,C", "c a", 0, "4"},
+		{QuestionTypeMultipleChoice, "ACD", "AB", 0, "0"},
+		{QuestionTypeTrueFalse, "√", "对", 0, "4"},
+		{QuestionTypeTrueFalse, "错误", "T", 0, "0"},
+		{QuestionTypeNumeric, "0.5", "1/2", 0, "4"},
+		{QuestionTypeNumeric, "x=3", "3.0", 0, "4"},
+		{QuestionTypeNumeric, "1.2m", "120 cm", 0, "4"},
+		{QuestionTypeNumeric, "1.2m", "120 g", 0, "0"},
+		{QuestionTypeNumeric, "3.14", "3.1416", 0.01, "4"},
+		{QuestionTypeNumeric, "3.14", "3.2", 0.01, "0"},
+		{QuestionTypeNumeric, "50%", "0.5", 0, "4"},
+		{QuestionTypeNumeric, "12", "twelve", 0, "0"},
+	}
+	for _, c := range cases {
+		got, err := GradeObjective(c.questionType, c.correct, c.student, full, c.tolerance)
+		if err != nil {
+			t.Errorf("GradeObjective(%s, %q, %q) error: %v", c.questionType, c.correct, c.student, err)
+			continue
+		}
+		if got.Score.String() != c.wantScore {
+			t.Errorf("GradeObjective(%s, %q, %q) score = %s, want %s", c.questionType, c.correct, c.student, got.Score, c.wantScore)
+		}
+	}
+}
+
+// 不是明确选项写法的作答交给智能体，而不是从中挑出字母判分
+func TestGradeObjectiveUnparsableChoice(t *testing.T) {
+	full := decimal.NewFromInt(4)
+	for _, c := range []struct {
+		questionType QuestionType
+		student      string
+	}{
+		{QuestionTypeSingleChoice, "Answer: B"},
+		{QuestionTypeSingleChoice, "I think A"},
+		{QuestionTypeSingleChoice, "选B"},
+		{QuestionTypeMultipleChoice, "A C 因为……"},
+		{QuestionTypeMultipleChoice, "CA"},
+		{QuestionTypeMultipleChoice, "BAD"},
+	} {
+		if _, err := GradeObjective(c.questionType, "AC", c.student, full, 0); !errors.Is(err, ErrUnparsableAnswer) {
+			if c.questionType == QuestionTypeSingleChoice {
+				_, err = GradeObjective(c.questionType, "B", c.student, full, 0)
+			}
+			if !errors.Is(err, ErrUnparsableAnswer) {
+				t.Errorf("GradeObjective(%s, %q) error = %v, want ErrUnparsableAnswer", c.questionType, c.student, err)
+			}
+		}
+	}
+}
+
+func TestGradeObjectiveUnparsableKey(t *testing.T) {
+	if _, err := GradeObjective(QuestionTypeSingleChoice, "见解析", "A", decimal.NewFromInt(1), 0); err == nil {
+		t.Error("expected error for an answer key without options")
+	}
+	if QuestionTypeOpen.IsObjective() {
+		t.Error("open questions must not be graded locally")
+	}
+}
@@ -0,0 +1,184 @@
+package grading
+
+import (
+	"database/sql/driver"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// GraderOutputSchemaVersion 是当前判卷输出的 schema 版本
+const GraderOutputSchemaVersion = "grader_output.v1"
+
+var ErrInvalidGraderOutput = errors.New("invalid grader output")
+
+//go:embed schema/*.json
+var schemaFS embed.FS
+
+var (
+	schemaMu sync.Mutex
+	schemas  = map[string]*gojsonschema.Schema{}
+)
+
+// StepNote 解题步骤的批注
+type StepNote struct {
+	Step    string `json:"step"`
+	Correct *bool  `json:"correct,omitempty"`
+	Note    string `json:"note,omitempty"`
+}
+
+// GraderOutput 是判卷 / 打分智能体的结构化输出
+type GraderOutput struct {
+	SchemaVersion string           `json:"schema_version"`
+	Score         decimal.Decimal  `json:"score"`
+	MaxScore      decimal.Decimal  `json:"max_score"`
+	Feedback      string           `json:"feedback,omitempty"`
+	Confidence    *float64         `json:"confidence,omitempty"`
+	Steps         []StepNote       `json:"steps,omitempty"`
+	Breakdown     []CriterionScore `json:"breakdown,omitempty"`
+}
+
+// ScoreResult 转换为打分结果，供满分校正与评分细则对齐使用
+func (o GraderOutput) ScoreResult() ScoreResult {
+	return ScoreResult{Score: o.Score, FullScore: o.MaxScore, Breakdown: o.Breakdown}
+}
+
+// ParseGraderOutput 从模型输出中提取 JSON，按声明的 schema 版本校验后解析。
+// 兼容旧版打分智能体的 {"full_score", "score"} 输出
+func ParseGraderOutput(text string) (GraderOutput, error) {
+	var output GraderOutput
+	raw, err := ExtractJSON(text)
+	if err != nil {
+		return output, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return output, fmt.Errorf("%w: %v", ErrInvalidGraderOutput, err)
+	}
+	upgradeLegacyOutput(doc)
+	version, _ := doc["schema_version"].(string)
+	if version == "" {
+		version = GraderOutputSchemaVersion
+		doc["schema_version"] = version
+	}
+	schema, err := loadSchema(version)
+	if err != nil {
+		return output, err
+	}
+	result, err := schema.Validate(gojsonschema.NewGoLoader(doc))
+	if err != nil {
+		return output, fmt.Errorf("%w: %v", ErrInvalidGraderOutput, err)
+	}
+	if !result.Valid() {
+		var reasons []string
+		for _, e := range result.Errors() {
+			reasons = append(reasons, e.String())
+		}
+		return output, fmt.Errorf("%w: %s", ErrInvalidGraderOutput, strings.Join(reasons, "; "))
+	}
+	normalized, _ := json.Marshal(doc)
+	if err := json.Unmarshal(normalized, &output); err != nil {
+		return output, fmt.Errorf("%w: %v", ErrInvalidGraderOutput, err)
+	}
+	if err := CheckScore(output.Score, output.MaxScore); err != nil {
+		return output, err
+	}
+	return output, nil
+}
+
+// upgradeLegacyOutput 将旧版 full_score 字段映射为 max_score
+func upgradeLegacyOutput(doc map[string]interface{}) {
+	if _, ok := doc["max_score"]; ok {
+		return
+	}
+	if fullScore, ok := doc["full_score"]; ok {
+		doc["max_score"] = fullScore
+		delete(doc, "full_score")
+	}
+}
+
+func loadSchema(version string) (*gojsonschema.Schema, error) {
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+	if schema, ok := schemas[version]; ok {
+		return schema, nil
+	}
+	data, err := schemaFS.ReadFile("schema/" + version + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown schema version %q", ErrInvalidGraderOutput, version)
+	}
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return nil, fmt.Errorf("load schema %s: %w", version, err)
+	}
+	schemas[version] = schema
+	return schema, nil
+}
+
+// ExtractJSON 从模型输出中取出 JSON 对象，兼容 ```json 代码块以及前后夹杂说明文字的情况
+func ExtractJSON(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if start := strings.Index(text, "```"); start >= 0 {
+		body := text[start+3:]
+		if end := strings.Index(body, "```"); end >= 0 {
+			body = body[:end]
+			// 去掉代码块的语言标记，例如 ```json
+			if nl := strings.IndexByte(body, '\n'); nl >= 0 && !strings.Contains(body[:nl], "{") {
+				body = body[nl+1:]
+			}
+			text = strings.TrimSpace(body)
+		}
+	}
+	start := strings.IndexByte(text, '{')
+	if start < 0 {
+		return "", fmt.Errorf("%w: no JSON object found", ErrInvalidGraderOutput)
+	}
+	depth, inString, escaped := 0, false, false
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return text[start : i+1], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: unterminated JSON object", ErrInvalidGraderOutput)
+}
+
+// Value 实现 driver.Valuer，未解析出结构化结果时存为 NULL
+func (o *GraderOutput) Value() (driver.Value, error) {
+	if o == nil {
+		return nil, nil
+	}
+	return json.Marshal(o)
+}
+
+// Scan 实现 sql.Scanner
+func (o *GraderOutput) Scan(src interface{}) error {
+	return scanJSON(src, o)
+}
+
+// ConfidenceValue 返回可写入数据库的置信度，没有时为 NULL
+func (o *GraderOutput) ConfidenceValue() interface{} {
+	if o == nil || o.Confidence == nil {
+		return nil
+	}
+	return *o.Confidence
+}
@@ -0,0 +1,43 @@
+package grading
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseGraderOutput(t *testing.T) {
+	text := "批改结果如下：\n```json\n{\"schema_version\": \"grader_output.v1\", \"score\": 7.5, \"max_score\": \"10\", \"feedback\": \"步骤 {2} 有误\", \"confidence\": 0.8, \"steps\": [{\"step\": \"列方程\", \"correct\": true}]}\n```"
+	got, err := ParseGraderOutput(text)
+	if err != nil {
+		t.Fatalf("ParseGraderOutput returned error: %v", err)
+	}
+	if got.Score.String() != "7.5" || got.MaxScore.String() != "10" || got.Confidence == nil || *got.Confidence != 0.8 || len(got.Steps) != 1 {
+		t.Errorf("unexpected output %+v", got)
+	}
+}
+
+func TestParseGraderOutputLegacy(t *testing.T) {
+	got, err := ParseGraderOutput(`{"full_score": "10", "score": "8"}`)
+	if err != nil {
+		t.Fatalf("ParseGraderOutput returned error: %v", err)
+	}
+	if got.SchemaVersion != GraderOutputSchemaVersion || got.MaxScore.String() != "10" || got.Score.String() != "8" {
+		t.Errorf("unexpected output %+v", got)
+	}
+}
+
+func TestParseGraderOutputInvalid(t *testing.T) {
+	cases := map[string]error{
+		`满分10分，得8分`:                                           ErrInvalidGraderOutput,
+		`{"score": "8分", "max_score": 10}`:                    ErrInvalidGraderOutput,
+		`{"score": 8, "max_score": 10, "confidence": 3}`:      ErrInvalidGraderOutput,
+		`{"schema_version": "grader_output.v9", "score": 1}`:  ErrInvalidGraderOutput,
+		`{"score": 12, "max_score": 10}`:                      ErrScoreOutOfRange,
+		`prefix {"score": 1, "max_score": 2, "feedback": "}"`: ErrInvalidGraderOutput,
+	}
+	for text, want := range cases {
+		if _, err := ParseGraderOutput(text); !errors.Is(err, want) {
+			t.Errorf("ParseGraderOutput(%s) = %v, want %v", text, err, want)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package grading
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"examination-papers/utils"
+)
+
+const (
+	// StageOutputText 阶段输出为自由文本
+	StageOutputText = "text"
+	// StageOutputGraderOutput 阶段输出需按 schema 解析为结构化分数
+	StageOutputGraderOutput = "grader_output"
+
+	// AppRefProfile 使用学科判卷配置中的 app id 与 prompt
+	AppRefProfile = "profile"
+	// AppRefProfileSingleCall 使用学科判卷配置中的 single_call app id 与 prompt
+	AppRefProfileSingleCall = "profile_single_call"
+
+	// PipelineExamItem 是题目预处理流水线的名称
+	PipelineExamItem = "exam_item"
+)
+
+var ErrStageFailed = errors.New("pipeline stage failed")
+
+// Stage 是流水线中的一次智能体调用
+type Stage struct {
+	Name           string            `json:"name"`
+	AppID          string            `json:"app_id,omitempty"`
+	AppIDEnv       string            `json:"app_id_env,omitempty"`
+	AppRef         string            `json:"app_ref,omitempty"` // profile / profile_single_call
+	Prompt         string            `json:"prompt,omitempty"`
+	Inputs         map[string]string `json:"inputs"` // biz_params 名称 -> 取值表达式
+	Output         string            `json:"output,omitempty"`
+	Retries        int               `json:"retries,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+	Optional       bool              `json:"optional,omitempty"` // 失败时不中断流水线，例如查重
+}
+
+// Pipeline 是按顺序执行的多阶段流水线。Outputs 将阶段结果映射为调用方需要的字段
+type Pipeline struct {
+	Name    string            `json:"name"`
+	Stages  []Stage           `json:"stages"`
+	Outputs map[string]string `json:"outputs"`
+}
+
+// StageResult 记录一个阶段的执行情况
+type StageResult struct {
+	Name        string
+	AppID       string
+	Prompt      string
+	Params      map[string]interface{}
+	Attempts    int
+	Duration    time.Duration
+	AgentResult *utils.AgentResult
+	Text        string
+	Output      *GraderOutput
+	Err         error
+	Calls       []StageCall // 每次调用的记录，包括重试
+}
+
+// StageCall 是阶段内的一次智能体调用
+type StageCall struct {
+	Attempt     int
+	AgentResult *utils.AgentResult // 请求失败时为 nil
+	Output      *GraderOutput      // 解析出的结构化分数，未解析或解析失败时为 nil
+	Duration    time.Duration
+	Err         error
+}
+
+// RunResult 是流水线的执行结果，阶段失败时 Outputs 只包含已成功阶段能算出的字段
+type RunResult struct {
+	Stages  []*StageResult
+	Outputs map[string]interface{}
+}
+
+// AgentCaller 调用一次智能体
+type AgentCaller func(ctx context.Context, appID, prompt string, bizParams map[string]interface{}) (*utils.AgentResult, error)
+
+// Text 返回输出字段的文本值
+func (r RunResult) Text(key string) string {
+	s, _ := r.Outputs[key].(string)
+	return s
+}
+
+// GraderOutput 返回输出字段中的结构化分数
+func (r RunResult) GraderOutput(key string) *GraderOutput {
+	o, _ := r.Outputs[key].(*GraderOutput)
+	return o
+}
+
+// builtinPipelines 复现原先写死在 worker 中的调用链，可被 PIPELINES_FILE 中的同名配置覆盖
+var builtinPipelines = []Pipeline{
+	{
+		Name: PipelineExamItem,
+		Stages: []Stage{
+			{
+				Name:     "process_answer",
+				AppIDEnv: "HANDLE_ANSWER_APPID",
+				Inputs:   map[string]string{"answer": "task.answer", "full_score": "task.full_score", "analysis": "task.analysis"},
+				Retries:  3,
+			},
+			{
+				Name:     "process_question",
+				AppIDEnv: "HANDLE_QUESTION_APPID",
+				Inputs:   map[string]string{"question": "task.body"},
+				Retries:  3,
+			},
+		},
+		Outputs: map[string]string{
+			"correct_answer_result": "stages.process_answer.text",
+			"body_result":           "stages.process_question.text",
+		},
+	},
+	{
+		Name: string(PipelineModeTwoStep),
+		Stages: []Stage{
+			{Name: "grade", AppRef: AppRefProfile, Inputs: answerInputs(), Retries: 3},
+			{
+				Name:     "score",
+				AppIDEnv: "HANDLE_SCORE_APPID",
+				Inputs: map[string]string{
+					"res":            "stages.grade.text",
+					"full_score":     "task.fullScore",
+					"rubric":         "task.rubricJSON",
+					"schema_version": "const:" + GraderOutputSchemaVersion,
+				},
+				Output:  StageOutputGraderOutput,
+				Retries: 3,
+			},
+		},
+		Outputs: map[string]string{"result": "stages.grade.text", "grader_output": "stages.score.output"},
+	},
+	{
+		Name: string(PipelineModeSingleCall),
+		Stages: []Stage{
+			{Name: "grade", AppRef: AppRefProfileSingleCall, Inputs: answerInputs(), Output: StageOutputGraderOutput, Retries: 3},
+		},
+		Outputs: map[string]string{"result": "stages.grade.feedback", "grader_output": "stages.grade.output"},
+	},
+}
+
+// answerInputs 是判卷阶段默认传给智能体的参数
+func answerInputs() map[string]string {
+	return map[string]string{
+		"studentAnswer":     "task.studentAnswer",
+		"studentAnswers":    "task.studentAnswers",
+		"studentAnswerText": "task.studentAnswerText",
+		"correctAnswer":     "task.correctAnswer",
+		"fullScore":         "task.fullScore",
+		"rubric":            "task.rubricText",
+		"schema_version":    "const:" + GraderOutputSchemaVersion,
+	}
+}
+
+// loadPipelines 加载内置流水线，并用 PIPELINES_FILE（JSON 数组）中的定义覆盖或新增
+func loadPipelines() (map[string]Pipeline, error) {
+	pipelines := map[string]Pipeline{}
+	for _, p := range builtinPipelines {
+		pipelines[p.Name] = p
+	}
+	path := os.Getenv("PIPELINES_FILE")
+	if path == "" {
+		return pipelines, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read pipelines: %w", err)
+	}
+	var custom []Pipeline
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("parse pipelines: %w", err)
+	}
+	for _, p := range custom {
+		if err := p.check(); err != nil {
+			return nil, err
+		}
+		pipelines[p.Name] = p
+	}
+	return pipelines, nil
+}
+
+// check 校验阶段名称唯一、表达式只引用前序阶段
+func (p Pipeline) check() error {
+	if p.Name == "" || len(p.Stages) == 0 {
+		return errors.New("pipeline must have a name and at least one stage")
+	}
+	seen := map[string]bool{}
+	for _, stage := range p.Stages {
+		if stage.Name == "" || seen[stage.Name] {
+			return fmt.Errorf("pipeline %s: stage name %q is empty or duplicated", p.Name, stage.Name)
+		}
+		if stage.AppID == "" && stage.AppIDEnv == "" && stage.AppRef == "" {
+			return fmt.Errorf("pipeline %s: stage %s has no app", p.Name, stage.Name)
+		}
+		for _, expr := range stage.Inputs {
+			if err := checkExpr(expr, seen); err != nil {
+				return fmt.Errorf("pipeline %s: stage %s: %w", p.Name, stage.Name, err)
+			}
+		}
+		seen[stage.Name] = true
+	}
+	for _, expr := range p.Outputs {
+		if err := checkExpr(expr, seen); err != nil {
+			return fmt.Errorf("pipeline %s: outputs: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// GradesAnswers 判断流水线能否用于判卷：grader_output 输出需取自解析结构化分数的阶段
+func (p Pipeline) GradesAnswers() bool {
+	expr, ok := p.Outputs["grader_output"]
+	if !ok || p.Name == PipelineExamItem {
+		return false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(expr, "stages."), ".", 2)
+	if len(parts) != 2 || parts[1] != "output" {
+		return false
+	}
+	for _, stage := range p.Stages {
+		if stage.Name == parts[0] {
+			return stage.Output == StageOutputGraderOutput
+		}
+	}
+	return false
+}
+
+// UsesProfileApp 判断流水线是否有阶段使用判卷配置中的智能体，只有这类阶段会采用申诉指定的 app id
+func (p Pipeline) UsesProfileApp() bool {
+	for _, stage := range p.Stages {
+		if stage.AppRef == AppRefProfile || stage.AppRef == AppRefProfileSingleCall {
+			return true
+		}
+	}
+	return false
+}
+
+func checkExpr(expr string, stages map[string]bool) error {
+	switch {
+	case strings.HasPrefix(expr, "task."), strings.HasPrefix(expr, "const:"):
+		return nil
+	case strings.HasPrefix(expr, "stages."):
+		parts := strings.SplitN(strings.TrimPrefix(expr, "stages."), ".", 2)
+		if len(parts) != 2 || !stages[parts[0]] {
+			return fmt.Errorf("expression %q must reference an earlier stage", expr)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported expression %q", expr)
+}
+
+// Run 依次执行各阶段。非 optional 阶段失败时停止并返回 ErrStageFailed，已得到的结果仍保留在 RunResult 中
+func (p Pipeline) Run(ctx context.Context, profile Profile, vars map[string]interface{}, call AgentCaller) (RunResult, error) {
+	result := RunResult{Outputs: map[string]interface{}{}}
+	done := map[string]*StageResult{}
+	var runErr error
+	for _, stage := range p.Stages {
+		sr := p.runStage(ctx, stage, profile, vars, done, call)
+		result.Stages = append(result.Stages, sr)
+		if sr.Err != nil {
+			if stage.Optional {
+				log.Printf("[Pipeline] Optional stage %s/%s failed: %v", p.Name, stage.Name, sr.Err)
+				continue
+			}
+			runErr = fmt.Errorf("%w: %s/%s: %v", ErrStageFailed, p.Name, stage.Name, sr.Err)
+			break
+		}
+		done[stage.Name] = sr
+	}
+	for key, expr := range p.Outputs {
+		if v := resolveExpr(expr, vars, done); v != nil {
+			result.Outputs[key] = v
+		}
+	}
+	return result, runErr
+}
+
+// resolveAppID 返回阶段实际调用的 app id：引用判卷配置时取配置中的值，否则取 AppID 或 AppIDEnv 环境变量
+func (stage Stage) resolveAppID(profile Profile) string {
+	switch {
+	case stage.AppRef == AppRefProfile:
+		return profile.AppID
+	case stage.AppRef == AppRefProfileSingleCall:
+		return profile.SingleCallAppID
+	case stage.AppID == "" && stage.AppIDEnv != "":
+		return os.Getenv(stage.AppIDEnv)
+	}
+	return stage.AppID
+}
+
+func (p Pipeline) runStage(ctx context.Context, stage Stage, profile Profile, vars map[string]interface{}, done map[string]*StageResult, call AgentCaller) *StageResult {
+	appID, prompt := stage.resolveAppID(profile), stage.Prompt
+	if prompt == "" && stage.AppRef != "" {
+		prompt = profile.Prompt
+	}
+	params := map[string]interface{}{}
+	for key, expr := range stage.Inputs {
+		if v := resolveExpr(expr, vars, done); v != nil {
+			params[key] = v
+		}
+	}
+	sr := &StageResult{Name: stage.Name, AppID: appID, Prompt: prompt, Params: params}
+	if appID == "" {
+		sr.Err = errors.New("app id is not configured")
+		return sr
+	}
+	retries := stage.Retries
+	if retries <= 0 {
+		retries = 1
+	}
+	start := time.Now()
+	defer func() { sr.Duration = time.Since(start) }()
+	for sr.Attempts < retries {
+		sr.Attempts++
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if stage.TimeoutSeconds > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, time.Duration(stage.TimeoutSeconds)*time.Second)
+		}
+		callStart := time.Now()
+		res, err := call(attemptCtx, appID, prompt, params)
+		cancel()
+		record := StageCall{Attempt: sr.Attempts, AgentResult: res, Duration: time.Since(callStart), Err: err}
+		if err != nil {
+			sr.Err = err
+			sr.Calls = append(sr.Calls, record)
+			log.Printf("[Pipeline] Stage %s/%s attempt %d/%d failed: %v", p.Name, stage.Name, sr.Attempts, retries, err)
+			continue
+		}
+		sr.AgentResult, sr.Text = res, res.Text
+		if stage.Output == StageOutputGraderOutput {
+			output, err := ParseGraderOutput(res.Text)
+			if err != nil {
+				sr.Err, record.Err = err, err
+				sr.Calls = append(sr.Calls, record)
+				log.Printf("[Pipeline] Stage %s/%s attempt %d/%d returned invalid output: %v", p.Name, stage.Name, sr.Attempts, retries, err)
+				continue
+			}
+			sr.Output, record.Output = &output, &output
+		}
+		sr.Calls = append(sr.Calls, record)
+		sr.Err = nil
+		return sr
+	}
+	return sr
+}
+
+// resolveExpr 解析取值表达式：task.<变量>、stages.<阶段>.text|output|feedback、const:<字面量>。
+// 取不到值或值为空字符串时返回 nil，对应参数不会传给智能体
+func resolveExpr(expr string, vars map[string]interface{}, done map[string]*StageResult) interface{} {
+	var v interface{}
+	switch {
+	case strings.HasPrefix(expr, "const:"):
+		v = strings.TrimPrefix(expr, "const:")
+	case strings.HasPrefix(expr, "task."):
+		v = vars[strings.TrimPrefix(expr, "task.")]
+	case strings.HasPrefix(expr, "stages."):
+		parts := strings.SplitN(strings.TrimPrefix(expr, "stages."), ".", 2)
+		sr, ok := done[parts[0]]
+		if !ok || len(parts) != 2 {
+			return nil
+		}
+		switch parts[1] {
+		case "text":
+			v = sr.Text
+		case "output":
+			if sr.Output != nil {
+				v = sr.Output
+			}
+		case "feedback":
+			v = sr.Text
+			if sr.Output != nil && sr.Output.Feedback != "" {
+				v = sr.Output.Feedback
+			}
+		}
+	}
+	switch value := v.(type) {
+	case string:
+		if value == "" {
+			return nil
+		}
+	case []string:
+		if len(value) == 0 {
+			return nil
+		}
+	}
+	return v
+}
@@ -0,0 +1,122 @@
+package grading
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"examination-papers/utils"
+)
+
+func TestPipelineRun(t *testing.T) {
+	p := Pipeline{
+		Name: "ocr_then_grade",
+		Stages: []Stage{
+			{Name: "ocr", AppID: "ocr-app", Inputs: map[string]string{"image": "task.studentAnswer"}},
+			{Name: "plagiarism", AppID: "dup-app", Optional: true, Inputs: map[string]string{"text": "stages.ocr.text"}},
+			{Name: "grade", AppRef: AppRefProfile, Retries: 2, Output: StageOutputGraderOutput,
+				Inputs: map[string]string{"text": "stages.ocr.text", "empty": "task.missing"}},
+		},
+		Outputs: map[string]string{"result": "stages.grade.feedback", "grader_output": "stages.grade.output"},
+	}
+	if err := p.check(); err != nil {
+		t.Fatal(err)
+	}
+	attempts := 0
+	call := func(ctx context.Context, appID, prompt string, params map[string]interface{}) (*utils.AgentResult, error) {
+		switch appID {
+		case "ocr-app":
+			return &utils.AgentResult{Text: "x=3"}, nil
+		case "dup-app":
+			return nil, errors.New("unavailable")
+		}
+		if params["text"] != "x=3" || params["empty"] != nil || prompt != "grade" {
+			t.Errorf("unexpected grade call: %q %v", prompt, params)
+		}
+		attempts++
+		if attempts == 1 {
+			return &utils.AgentResult{Text: "not json"}, nil
+		}
+		return &utils.AgentResult{Text: `{"schema_version":"grader_output.v1","score":2,"max_score":4,"feedback":"ok"}`}, nil
+	}
+	run, err := p.Run(context.Background(), Profile{AppID: "grade-app", Prompt: "grade"}, map[string]interface{}{"studentAnswer": "u"}, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Text("result") != "ok" || run.GraderOutput("grader_output") == nil || attempts != 2 {
+		t.Errorf("unexpected run result: %+v, attempts %d", run.Outputs, attempts)
+	}
+	calls := run.Stages[2].Calls
+	if len(calls) != 2 || calls[0].Err == nil || calls[0].AgentResult.Text != "not json" || calls[1].Output == nil {
+		t.Errorf("unexpected stage calls %+v", calls)
+	}
+	if run.Stages[1].Err == nil || run.Stages[2].Attempts != 2 {
+		t.Errorf("unexpected stage results")
+	}
+}
+
+func TestPipelineRunStopsOnFailure(t *testing.T) {
+	p := Pipeline{
+		Name:    "two",
+		Stages:  []Stage{{Name: "a", AppID: "a"}, {Name: "b", AppID: "b"}},
+		Outputs: map[string]string{"first": "stages.a.text", "second": "stages.b.text"},
+	}
+	calls := 0
+	call := func(ctx context.Context, appID, prompt string, params map[string]interface{}) (*utils.AgentResult, error) {
+		calls++
+		return nil, errors.New("down")
+	}
+	run, err := p.Run(context.Background(), Profile{}, nil, call)
+	if !errors.Is(err, ErrStageFailed) || calls != 1 || len(run.Outputs) != 0 {
+		t.Errorf("Run() = %v, %d calls, outputs %v", err, calls, run.Outputs)
+	}
+}
+
+func TestPipelineCheck(t *testing.T) {
+	bad := []Pipeline{
+		{Name: "empty"},
+		{Name: "forward", Stages: []Stage{{Name: "a", AppID: "a", Inputs: map[string]string{"x": "stages.b.text"}}, {Name: "b", AppID: "b"}}},
+		{Name: "noapp", Stages: []Stage{{Name: "a"}}},
+		{Name: "dup", Stages: []Stage{{Name: "a", AppID: "a"}, {Name: "a", AppID: "a"}}},
+	}
+	for _, p := range bad {
+		if err := p.check(); err == nil {
+			t.Errorf("check(%s) should fail", p.Name)
+		}
+	}
+}
+
+func TestPipelineGradesAnswers(t *testing.T) {
+	pipelines := map[string]Pipeline{}
+	for _, p := range builtinPipelines {
+		pipelines[p.Name] = p
+	}
+	fixed := Pipeline{
+		Name:    "fixed",
+		Stages:  []Stage{{Name: "grade", AppID: "fixed-app", Output: StageOutputGraderOutput}},
+		Outputs: map[string]string{"grader_output": "stages.grade.output"},
+	}
+	textOnly := Pipeline{
+		Name:    "text_only",
+		Stages:  []Stage{{Name: "grade", AppRef: AppRefProfile}},
+		Outputs: map[string]string{"grader_output": "stages.grade.text"},
+	}
+	cases := []struct {
+		pipeline        Pipeline
+		grades, usesApp bool
+	}{
+		{pipelines[PipelineExamItem], false, false},
+		{pipelines[string(PipelineModeTwoStep)], true, true},
+		{pipelines[string(PipelineModeSingleCall)], true, true},
+		{fixed, true, false},
+		{textOnly, false, true},
+	}
+	for _, c := range cases {
+		if got := c.pipeline.GradesAnswers(); got != c.grades {
+			t.Errorf("%s: GradesAnswers = %v, want %v", c.pipeline.Name, got, c.grades)
+		}
+		if got := c.pipeline.UsesProfileApp(); got != c.usesApp {
+			t.Errorf("%s: UsesProfileApp = %v, want %v", c.pipeline.Name, got, c.usesApp)
+		}
+	}
+}
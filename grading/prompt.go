@@ -0,0 +1,75 @@
+package grading
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// PromptTemplate 是某学科判卷 prompt 的一个版本，Body 为 text/template，
+// 可引用流水线的任务变量，如 {{.subject}}、{{.fullScore}}、{{.rubricText}}
+type PromptTemplate struct {
+	ID        int64     `json:"id" db:"id"`
+	Subject   string    `json:"subject" db:"subject"`
+	Version   int       `json:"version" db:"version"`
+	Body      string    `json:"body" db:"body"`
+	Active    bool      `json:"active" db:"active"` // 未固定版本的考试使用该学科启用的版本
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// PromptVariables 是判卷任务提供给 prompt 模板的变量。部分变量（如 fullScore、rubricText）只在题目有相应设置时提供，
+// 缺省时按空串渲染；模板引用其他变量时渲染失败
+var PromptVariables = []string{
+	"studentAnswer", "studentAnswers", "studentAnswerText", "correctAnswer", "body", "subject", "questionType",
+	"examId", "itemId", "blockId", "studentId", "fullScore", "rubricText", "rubricJSON",
+}
+
+// ParsePromptTemplate 校验模板语法，并以全部变量为空串试渲染一次，拒绝引用未声明变量的模板
+func ParsePromptTemplate(body string) (*template.Template, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, fmt.Errorf("prompt template is empty")
+	}
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, promptVars(nil)); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// Render 用任务变量渲染 prompt。未提供的声明变量渲染为空串
+func (t PromptTemplate) Render(vars map[string]interface{}) (string, error) {
+	tmpl, err := ParsePromptTemplate(t.Body)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, promptVars(vars)); err != nil {
+		return "", fmt.Errorf("render prompt %s v%d: %w", t.Subject, t.Version, err)
+	}
+	return b.String(), nil
+}
+
+// promptVars 复制任务变量，并为未提供的声明变量补上空串
+func promptVars(vars map[string]interface{}) map[string]interface{} {
+	filled := make(map[string]interface{}, len(PromptVariables)+len(vars))
+	for _, name := range PromptVariables {
+		filled[name] = ""
+	}
+	for name, value := range vars {
+		filled[name] = value
+	}
+	return filled
+}
+
+// NormalizeSubject 统一学科写法，空学科视为默认学科
+func NormalizeSubject(subject string) string {
+	if subject = normalizeKey(subject); subject == "" {
+		return DefaultSubject
+	}
+	return subject
+}
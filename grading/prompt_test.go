@@ -0,0 +1,24 @@
+package grading
+
+import "testing"
+
+func TestPromptTemplateRender(t *testing.T) {
+	tmpl := PromptTemplate{Subject: "math", Version: 2, Body: "批改{{.subject}}题，满分 {{.fullScore}} 分。{{if .rubricText}}评分细则：{{.rubricText}}{{end}}{{.body}}"}
+	got, err := tmpl.Render(map[string]interface{}{"subject": "math", "fullScore": "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "批改math题，满分 5 分。"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+	// 引用未声明的变量时拒绝模板，而不是渲染出空串
+	if _, err := ParsePromptTemplate("{{.missing}}"); err == nil {
+		t.Error("expected error for an undeclared variable")
+	}
+	if _, err := ParsePromptTemplate("{{.subject"); err == nil {
+		t.Error("expected parse error")
+	}
+	if _, err := ParsePromptTemplate("  "); err == nil {
+		t.Error("expected error for empty template")
+	}
+}
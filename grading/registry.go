@@ -0,0 +1,214 @@
+package grading
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"examination-papers/utils"
+)
+
+// DefaultSubject 是未指定学科时使用的学科，兼容只有数学判卷的旧数据
+const DefaultSubject = "math"
+
+// PipelineMode 决定一道作答的判卷需要几次智能体调用
+type PipelineMode string
+
+const (
+	// PipelineModeTwoStep 先由判卷智能体输出评语，再由打分智能体把评语转为结构化分数
+	PipelineModeTwoStep PipelineMode = "two_step"
+	// PipelineModeSingleCall 由一个智能体同时返回评语与结构化分数
+	PipelineModeSingleCall PipelineMode = "single_call"
+)
+
+// DefaultPipelineMode 读取 GRADING_PIPELINE_MODE，默认 two_step
+func DefaultPipelineMode() PipelineMode {
+	if PipelineMode(os.Getenv("GRADING_PIPELINE_MODE")) == PipelineModeSingleCall {
+		return PipelineModeSingleCall
+	}
+	return PipelineModeTwoStep
+}
+
+// Profile 描述某学科（可细化到题型）使用的判卷智能体与 prompt
+type Profile struct {
+	Subject      string    `json:"subject"`
+	QuestionType string    `json:"question_type,omitempty"` // 为空表示该学科的所有题型
+	AppID        string    `json:"app_id,omitempty"`
+	AppIDEnv     string    `json:"app_id_env,omitempty"` // 从环境变量读取 app id
+	Prompt       string    `json:"prompt,omitempty"`
+	ImageMode    ImageMode `json:"image_mode,omitempty"`
+
+	Mode               PipelineMode `json:"mode,omitempty"`                   // 为空时使用 GRADING_PIPELINE_MODE
+	SingleCallAppID    string       `json:"single_call_app_id,omitempty"`     // single_call 模式下同时输出评语与分数的智能体
+	SingleCallAppIDEnv string       `json:"single_call_app_id_env,omitempty"` // 从环境变量读取 single_call app id
+	Pipeline           string       `json:"pipeline,omitempty"`               // 自定义流水线名称，为空时按 mode 选择内置流水线
+}
+
+// PipelineMode 返回该配置实际使用的判卷模式；未配置 single_call 智能体时退回 two_step
+func (p Profile) PipelineMode() PipelineMode {
+	mode := p.Mode
+	if mode == "" {
+		mode = DefaultPipelineMode()
+	}
+	if mode == PipelineModeSingleCall && p.SingleCallAppID == "" {
+		return PipelineModeTwoStep
+	}
+	return mode
+}
+
+// Registry 维护学科 / 题型到判卷配置的映射
+type Registry struct {
+	profiles  map[string]Profile
+	pipelines map[string]Pipeline
+}
+
+// defaultProfiles 是未提供 GRADING_REGISTRY_FILE 时的内置映射
+var defaultProfiles = []Profile{
+	{Subject: "math", AppIDEnv: "EXAM_PAPER_MATH_APPID", SingleCallAppIDEnv: "EXAM_PAPER_MATH_SINGLE_CALL_APPID"},
+	{Subject: "english", AppIDEnv: "EXAM_PAPER_ENGLISH_APPID", SingleCallAppIDEnv: "EXAM_PAPER_ENGLISH_SINGLE_CALL_APPID", Prompt: "请批改这道英语题"},
+	{Subject: "chinese", AppIDEnv: "EXAM_PAPER_CHINESE_APPID", SingleCallAppIDEnv: "EXAM_PAPER_CHINESE_SINGLE_CALL_APPID", Prompt: "请批改这道语文题"},
+	{Subject: "physics", AppIDEnv: "EXAM_PAPER_SCIENCE_APPID", SingleCallAppIDEnv: "EXAM_PAPER_SCIENCE_SINGLE_CALL_APPID", Prompt: "请批改这道物理题"},
+	{Subject: "chemistry", AppIDEnv: "EXAM_PAPER_SCIENCE_APPID", SingleCallAppIDEnv: "EXAM_PAPER_SCIENCE_SINGLE_CALL_APPID", Prompt: "请批改这道化学题"},
+	{Subject: "biology", AppIDEnv: "EXAM_PAPER_SCIENCE_APPID", SingleCallAppIDEnv: "EXAM_PAPER_SCIENCE_SINGLE_CALL_APPID", Prompt: "请批改这道生物题"},
+}
+
+// NewRegistryFromEnv 优先从 GRADING_REGISTRY_FILE 指定的 JSON 文件加载配置，否则使用内置映射；
+// 流水线定义额外从 PIPELINES_FILE 加载
+func NewRegistryFromEnv() (*Registry, error) {
+	profiles := defaultProfiles
+	if path := os.Getenv("GRADING_REGISTRY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read grading registry: %w", err)
+		}
+		if err := json.Unmarshal(data, &profiles); err != nil {
+			return nil, fmt.Errorf("parse grading registry: %w", err)
+		}
+	}
+	r, err := NewRegistry(profiles)
+	if err != nil {
+		return nil, err
+	}
+	if r.pipelines, err = loadPipelines(); err != nil {
+		return nil, err
+	}
+	for _, p := range r.profiles {
+		if _, err := r.PipelineFor(p); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// NewRegistry 根据给定配置构造 Registry，必须包含默认学科
+func NewRegistry(profiles []Profile) (*Registry, error) {
+	r := &Registry{profiles: map[string]Profile{}, pipelines: map[string]Pipeline{}}
+	for _, p := range builtinPipelines {
+		r.pipelines[p.Name] = p
+	}
+	for _, p := range profiles {
+		p.Subject = normalizeKey(p.Subject)
+		p.QuestionType = normalizeKey(p.QuestionType)
+		if p.AppID == "" && p.AppIDEnv != "" {
+			p.AppID = os.Getenv(p.AppIDEnv)
+		}
+		if p.SingleCallAppID == "" && p.SingleCallAppIDEnv != "" {
+			p.SingleCallAppID = os.Getenv(p.SingleCallAppIDEnv)
+		}
+		if p.Prompt == "" {
+			p.Prompt = utils.DefaultAgentPrompt
+		}
+		r.profiles[registryKey(p.Subject, p.QuestionType)] = p
+	}
+	if _, ok := r.profiles[registryKey(DefaultSubject, "")]; !ok {
+		return nil, fmt.Errorf("grading registry must define subject %q", DefaultSubject)
+	}
+	return r, nil
+}
+
+// Supports 判断学科是否已配置且设置了判卷智能体，app id 的环境变量未设置的学科在提交时即拒绝，
+// 而不是判卷时退回默认学科的智能体
+func (r *Registry) Supports(subject string) bool {
+	subject = normalizeKey(subject)
+	if subject == "" {
+		subject = DefaultSubject
+	}
+	p, ok := r.profiles[registryKey(subject, "")]
+	return ok && p.hasApp()
+}
+
+// hasApp 判断配置是否设置了实际使用的判卷智能体
+func (p Profile) hasApp() bool {
+	return p.AppID != "" || p.PipelineMode() == PipelineModeSingleCall
+}
+
+// HasApp 判断 app id 是否为某个判卷配置使用的智能体，申诉指定其他智能体重判时校验
+func (r *Registry) HasApp(appID string) bool {
+	if appID == "" {
+		return false
+	}
+	for _, p := range r.profiles {
+		if p.AppID == appID || p.SingleCallAppID == appID {
+			return true
+		}
+	}
+	return false
+}
+
+// Subjects 返回已配置判卷智能体的学科列表
+func (r *Registry) Subjects() []string {
+	var subjects []string
+	for _, p := range r.profiles {
+		if p.QuestionType == "" && p.hasApp() {
+			subjects = append(subjects, p.Subject)
+		}
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// Resolve 按 学科+题型 -> 学科 -> 默认学科 的顺序查找判卷配置。
+// 配置了但 app id 为空（环境变量未设置）时同样回退，避免请求发到空应用；这类学科已由 Supports 在提交时拒绝
+func (r *Registry) Resolve(subject, questionType string) Profile {
+	subject, questionType = normalizeKey(subject), normalizeKey(questionType)
+	if subject == "" {
+		subject = DefaultSubject
+	}
+	for _, key := range []string{registryKey(subject, questionType), registryKey(subject, "")} {
+		if p, ok := r.profiles[key]; ok && p.hasApp() {
+			return p
+		}
+	}
+	if subject != DefaultSubject {
+		log.Printf("[Registry] No grading app configured for subject %q, falling back to %q", subject, DefaultSubject)
+	}
+	return r.profiles[registryKey(DefaultSubject, "")]
+}
+
+// Pipeline 按名称查找流水线
+func (r *Registry) Pipeline(name string) (Pipeline, error) {
+	p, ok := r.pipelines[name]
+	if !ok {
+		return Pipeline{}, fmt.Errorf("pipeline %q is not defined", name)
+	}
+	return p, nil
+}
+
+// PipelineFor 返回判卷配置使用的流水线：优先使用配置指定的流水线，否则按判卷模式选择内置流水线
+func (r *Registry) PipelineFor(profile Profile) (Pipeline, error) {
+	if profile.Pipeline != "" {
+		return r.Pipeline(profile.Pipeline)
+	}
+	return r.Pipeline(string(profile.PipelineMode()))
+}
+
+func registryKey(subject, questionType string) string {
+	return subject + "/" + questionType
+}
+
+func normalizeKey(v string) string {
+	return strings.ToLower(strings.TrimSpace(v))
+}
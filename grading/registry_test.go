@@ -0,0 +1,43 @@
+package grading
+
+import "testing"
+
+func TestRegistryResolve(t *testing.T) {
+	r, err := NewRegistry([]Profile{
+		{Subject: "math", AppID: "math-app"},
+		{Subject: "english", AppID: "english-app", Prompt: "grade english"},
+		{Subject: "english", QuestionType: "essay", AppID: "essay-app"},
+		{Subject: "physics"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct{ subject, questionType, want string }{
+		{"", "", "math-app"},
+		{"English", "", "english-app"},
+		{"english", "essay", "essay-app"},
+		{"english", "single_choice", "english-app"},
+		{"physics", "", "math-app"},
+		{"history", "", "math-app"},
+	}
+	for _, c := range cases {
+		if got := r.Resolve(c.subject, c.questionType).AppID; got != c.want {
+			t.Errorf("Resolve(%q, %q) = %q, want %q", c.subject, c.questionType, got, c.want)
+		}
+	}
+	if !r.Supports("english") || !r.Supports("") || r.Supports("history") {
+		t.Error("Supports should reflect configured subjects")
+	}
+	if r.Supports("physics") {
+		t.Error("Supports should reject subjects without a grading app")
+	}
+	if !r.HasApp("essay-app") || r.HasApp("unknown-app") || r.HasApp("") {
+		t.Error("HasApp should only accept configured app ids")
+	}
+}
+
+func TestNewRegistryRequiresDefaultSubject(t *testing.T) {
+	if _, err := NewRegistry([]Profile{{Subject: "english", AppID: "a"}}); err == nil {
+		t.Error("expected error when the default subject is missing")
+	}
+}
@@ -0,0 +1,53 @@
+package grading
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// ReviewReasonFailed 智能体判卷失败
+	ReviewReasonFailed = "failed"
+	// ReviewReasonLowConfidence 模型自评置信度低于阈值
+	ReviewReasonLowConfidence = "low_confidence"
+	// ReviewReasonFullScoreMismatch 模型给出的满分与题目满分不一致
+	ReviewReasonFullScoreMismatch = "full_score_mismatch"
+	// ReviewReasonScoreAnomaly 模型总分与逐条得分之和相差过大
+	ReviewReasonScoreAnomaly = "score_anomaly"
+	// ReviewReasonPartialAnswer 部分作答图片超出数量上限或下载失败，未参与判卷
+	ReviewReasonPartialAnswer = "partial_answer"
+)
+
+// ReviewConfidenceThreshold 读取 GRADING_REVIEW_CONFIDENCE，默认 0.6
+func ReviewConfidenceThreshold() float64 {
+	if v, err := strconv.ParseFloat(os.Getenv("GRADING_REVIEW_CONFIDENCE"), 64); err == nil && v >= 0 && v <= 1 {
+		return v
+	}
+	return 0.6
+}
+
+// anomalyRatio 模型总分与细则得分之和的差值超过满分的该比例时视为异常
+var anomalyRatio = decimal.NewFromFloat(0.2)
+
+// ReviewReasons 返回作答需要人工复核的原因，不需要复核时返回 nil
+func ReviewReasons(success bool, output *GraderOutput, final FinalScore, threshold float64) []string {
+	if !success || output == nil {
+		return []string{ReviewReasonFailed}
+	}
+	var reasons []string
+	if output.Confidence != nil && *output.Confidence < threshold {
+		reasons = append(reasons, ReviewReasonLowConfidence)
+	}
+	if final.FullScoreMismatch {
+		reasons = append(reasons, ReviewReasonFullScoreMismatch)
+	}
+	if len(final.Breakdown) > 0 && final.FullScore.IsPositive() {
+		modelScore, _ := Reconcile(output.ScoreResult(), final.FullScore)
+		if modelScore.Sub(final.Score).Abs().GreaterThan(final.FullScore.Mul(anomalyRatio)) {
+			reasons = append(reasons, ReviewReasonScoreAnomaly)
+		}
+	}
+	return reasons
+}
@@ -0,0 +1,31 @@
+package grading
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestReviewReasons(t *testing.T) {
+	ten := decimal.NewFromInt(10)
+	low, high := 0.3, 0.9
+	cases := []struct {
+		success bool
+		output  *GraderOutput
+		final   FinalScore
+		want    string
+	}{
+		{false, nil, FinalScore{}, "failed"},
+		{true, &GraderOutput{Score: decimal.NewFromInt(8), MaxScore: ten, Confidence: &high}, FinalScore{Score: decimal.NewFromInt(8), FullScore: ten}, ""},
+		{true, &GraderOutput{Score: decimal.NewFromInt(8), MaxScore: ten, Confidence: &low}, FinalScore{Score: decimal.NewFromInt(8), FullScore: ten}, "low_confidence"},
+		{true, &GraderOutput{Score: decimal.NewFromInt(4), MaxScore: decimal.NewFromInt(5)}, FinalScore{Score: decimal.NewFromInt(8), FullScore: ten, FullScoreMismatch: true}, "full_score_mismatch"},
+		{true, &GraderOutput{Score: decimal.NewFromInt(9), MaxScore: ten}, FinalScore{Score: decimal.NewFromInt(5), FullScore: ten, Breakdown: Breakdown{{CriterionID: "a"}}}, "score_anomaly"},
+		{true, &GraderOutput{Score: decimal.NewFromInt(6), MaxScore: ten}, FinalScore{Score: decimal.NewFromInt(5), FullScore: ten, Breakdown: Breakdown{{CriterionID: "a"}}}, ""},
+	}
+	for i, c := range cases {
+		if got := strings.Join(ReviewReasons(c.success, c.output, c.final, 0.6), ","); got != c.want {
+			t.Errorf("case %d: ReviewReasons() = %q, want %q", i, got, c.want)
+		}
+	}
+}
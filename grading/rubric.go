@@ -0,0 +1,173 @@
+package grading
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// CriterionKindPoint 独立的得分点，互不依赖
+	CriterionKindPoint = "point"
+	// CriterionKindStep 按解题顺序给分的步骤分，前序步骤未得满分时后续步骤仅在标记 follow_through（思路正确）时给分
+	CriterionKindStep = "step"
+)
+
+// Criterion 评分细则中的一条
+type Criterion struct {
+	ID          string          `json:"id" validate:"required"`
+	Description string          `json:"description" validate:"required"`
+	Points      decimal.Decimal `json:"points" validate:"required,gt=0"`
+	Kind        string          `json:"kind,omitempty" validate:"omitempty,oneof=point step"`
+}
+
+// Rubric 题目的结构化评分细则
+type Rubric struct {
+	Criteria []Criterion `json:"criteria" validate:"dive"`
+}
+
+// CriterionScore 某条细则的得分
+type CriterionScore struct {
+	CriterionID   string          `json:"criterion_id"`
+	Awarded       decimal.Decimal `json:"awarded"`
+	Max           decimal.Decimal `json:"max"`
+	Comment       string          `json:"comment,omitempty"`
+	FollowThrough bool            `json:"follow_through,omitempty"` // 前序步骤出错后本步骤基于错误结果思路正确，仍可给分
+}
+
+// Breakdown 按细则拆分的得分明细，存储为 JSONB
+type Breakdown []CriterionScore
+
+// IsEmpty 判断是否配置了评分细则
+func (r Rubric) IsEmpty() bool {
+	return len(r.Criteria) == 0
+}
+
+// Total 返回所有细则分值之和
+func (r Rubric) Total() decimal.Decimal {
+	total := decimal.Zero
+	for _, c := range r.Criteria {
+		total = total.Add(c.Points)
+	}
+	return total
+}
+
+// Check 校验细则 ID 唯一，且分值之和等于题目满分
+func (r Rubric) Check(fullScore decimal.Decimal) error {
+	seen := map[string]bool{}
+	for _, c := range r.Criteria {
+		if seen[c.ID] {
+			return fmt.Errorf("duplicate criterion id %q", c.ID)
+		}
+		seen[c.ID] = true
+	}
+	if !r.IsEmpty() && !r.Total().Equal(fullScore) {
+		return fmt.Errorf("criteria points add up to %s, want full score %s", r.Total(), fullScore)
+	}
+	return nil
+}
+
+// PromptText 将细则渲染为给判卷智能体的文本
+func (r Rubric) PromptText() string {
+	var b strings.Builder
+	hasStep := false
+	for i, c := range r.Criteria {
+		kind := "得分点"
+		if c.Kind == CriterionKindStep {
+			kind = "步骤分"
+			hasStep = true
+		}
+		fmt.Fprintf(&b, "%d. [%s] %s（%s，%s 分）\n", i+1, c.ID, c.Description, kind, c.Points)
+	}
+	if hasStep {
+		b.WriteString("步骤分按顺序给分：前面的步骤未得满分时，后续步骤仅在基于前一步结果思路正确时给分，并在该步骤的 breakdown 中标记 follow_through 为 true\n")
+	}
+	return b.String()
+}
+
+// ApplyBreakdown 将模型给出的逐条得分对齐到细则：未给出的细则记 0 分，
+// 每条得分裁剪到 [0, points]，未知细则忽略。步骤分依赖前序步骤：已有步骤未得满分时，
+// 后续步骤只有标记了 follow_through 才给分。返回对齐后的明细及总分
+func (r Rubric) ApplyBreakdown(scores []CriterionScore) (Breakdown, decimal.Decimal) {
+	byID := map[string]CriterionScore{}
+	for _, s := range scores {
+		byID[s.CriterionID] = s
+	}
+	breakdown := make(Breakdown, 0, len(r.Criteria))
+	total := decimal.Zero
+	stepMissed := false
+	for _, c := range r.Criteria {
+		s, ok := byID[c.ID]
+		if !ok {
+			s = CriterionScore{Comment: "未作答或未识别到该得分点"}
+		}
+		awarded := s.Awarded
+		if awarded.IsNegative() {
+			awarded = decimal.Zero
+		}
+		if awarded.GreaterThan(c.Points) {
+			awarded = c.Points
+		}
+		comment := s.Comment
+		if c.Kind == CriterionKindStep {
+			if stepMissed && !s.FollowThrough && awarded.IsPositive() {
+				awarded = decimal.Zero
+				comment = "前序步骤错误，本步骤不得分"
+			}
+			if awarded.LessThan(c.Points) {
+				stepMissed = true
+			}
+		}
+		breakdown = append(breakdown, CriterionScore{
+			CriterionID:   c.ID,
+			Awarded:       awarded,
+			Max:           c.Points,
+			Comment:       comment,
+			FollowThrough: s.FollowThrough,
+		})
+		total = total.Add(awarded)
+	}
+	return breakdown, total
+}
+
+// Value 实现 driver.Valuer，空细则存为 NULL
+func (r Rubric) Value() (driver.Value, error) {
+	if r.IsEmpty() {
+		return nil, nil
+	}
+	return json.Marshal(r)
+}
+
+// Scan 实现 sql.Scanner
+func (r *Rubric) Scan(src interface{}) error {
+	return scanJSON(src, r)
+}
+
+// Value 实现 driver.Valuer，空明细存为 NULL
+func (b Breakdown) Value() (driver.Value, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(b)
+}
+
+// Scan 实现 sql.Scanner
+func (b *Breakdown) Scan(src interface{}) error {
+	return scanJSON(src, b)
+}
+
+func scanJSON(src interface{}, dest interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	}
+	return errors.New("unsupported JSON column type")
+}
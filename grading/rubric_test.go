@@ -0,0 +1,64 @@
+package grading
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func testRubric() Rubric {
+	return Rubric{Criteria: []Criterion{
+		{ID: "setup", Description: "列出方程", Points: decimal.NewFromInt(2), Kind: CriterionKindStep},
+		{ID: "solve", Description: "求解", Points: decimal.NewFromInt(3), Kind: CriterionKindStep},
+		{ID: "answer", Description: "作答", Points: decimal.NewFromInt(1)},
+	}}
+}
+
+func TestRubricCheck(t *testing.T) {
+	r := testRubric()
+	if err := r.Check(decimal.NewFromInt(6)); err != nil {
+		t.Errorf("Check returned error: %v", err)
+	}
+	if err := r.Check(decimal.NewFromInt(10)); err == nil {
+		t.Error("expected error when criteria do not add up to the full score")
+	}
+	r.Criteria = append(r.Criteria, Criterion{ID: "setup", Description: "dup", Points: decimal.NewFromInt(1)})
+	if err := r.Check(decimal.NewFromInt(7)); err == nil {
+		t.Error("expected error for duplicate criterion ids")
+	}
+	if err := (Rubric{}).Check(decimal.NewFromInt(5)); err != nil {
+		t.Errorf("empty rubric should always pass, got %v", err)
+	}
+}
+
+func TestRubricApplyBreakdown(t *testing.T) {
+	breakdown, total := testRubric().ApplyBreakdown([]CriterionScore{
+		{CriterionID: "setup", Awarded: decimal.NewFromInt(2)},
+		{CriterionID: "solve", Awarded: decimal.NewFromInt(5), Comment: "超出分值"},
+		{CriterionID: "unknown", Awarded: decimal.NewFromInt(4)},
+	})
+	if total.String() != "5" {
+		t.Errorf("total = %s, want 5", total)
+	}
+	if len(breakdown) != 3 || breakdown[1].Awarded.String() != "3" || !breakdown[2].Awarded.IsZero() {
+		t.Errorf("unexpected breakdown %+v", breakdown)
+	}
+}
+
+func TestRubricApplyBreakdownStepDependency(t *testing.T) {
+	scores := []CriterionScore{
+		{CriterionID: "setup", Awarded: decimal.NewFromInt(1)},
+		{CriterionID: "solve", Awarded: decimal.NewFromInt(3)},
+		{CriterionID: "answer", Awarded: decimal.NewFromInt(1)},
+	}
+	breakdown, total := testRubric().ApplyBreakdown(scores)
+	if total.String() != "2" || !breakdown[1].Awarded.IsZero() {
+		t.Errorf("step after a missed step should get no credit, got %+v", breakdown)
+	}
+
+	scores[1].FollowThrough = true
+	breakdown, total = testRubric().ApplyBreakdown(scores)
+	if total.String() != "5" || breakdown[1].Awarded.String() != "3" {
+		t.Errorf("follow-through step should keep its credit, got %+v", breakdown)
+	}
+}
@@ -0,0 +1,76 @@
+package grading
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrScoreOutOfRange = errors.New("score out of range")
+
+// ScoreResult 打分智能体返回的分数，兼容 "8" 与 8 两种写法
+type ScoreResult struct {
+	FullScore decimal.Decimal  `json:"full_score"`
+	Score     decimal.Decimal  `json:"score"`
+	Breakdown []CriterionScore `json:"breakdown,omitempty"` // 配置了评分细则时的逐条得分
+}
+
+// CheckScore 校验分数不为负且不超过满分
+func CheckScore(score, fullScore decimal.Decimal) error {
+	if !fullScore.IsPositive() {
+		return fmt.Errorf("%w: full score %s must be positive", ErrScoreOutOfRange, fullScore)
+	}
+	if score.IsNegative() || score.GreaterThan(fullScore) {
+		return fmt.Errorf("%w: score %s not within [0, %s]", ErrScoreOutOfRange, score, fullScore)
+	}
+	return nil
+}
+
+// Reconcile 以题目提交时的满分为准校正模型给出的分数：
+// 模型满分与题目满分不一致时按比例换算并标记 mismatch，最后裁剪到 [0, itemFullScore]
+func Reconcile(result ScoreResult, itemFullScore decimal.Decimal) (score decimal.Decimal, mismatch bool) {
+	score = result.Score
+	if !result.FullScore.Equal(itemFullScore) {
+		mismatch = true
+		if result.FullScore.IsPositive() {
+			score = score.Mul(itemFullScore).Div(result.FullScore).Round(2)
+		}
+	}
+	if score.IsNegative() {
+		score = decimal.Zero
+	}
+	if score.GreaterThan(itemFullScore) {
+		score = itemFullScore
+	}
+	return score, mismatch
+}
+
+// FinalScore 是写回作答块的最终分数
+type FinalScore struct {
+	Score             decimal.Decimal
+	FullScore         decimal.Decimal
+	ModelFullScore    decimal.Decimal
+	FullScoreMismatch bool
+	Breakdown         Breakdown
+}
+
+// Finalize 综合模型输出、题目满分与评分细则得出最终分数：
+// 有细则且模型给出逐条得分时以细则为准；否则以题目满分校正；旧题目没有满分时直接采用模型结果
+func Finalize(output GraderOutput, itemFullScore decimal.NullDecimal, rubric Rubric) FinalScore {
+	result := output.ScoreResult()
+	final := FinalScore{ModelFullScore: result.FullScore}
+	switch {
+	case !rubric.IsEmpty() && len(result.Breakdown) > 0:
+		final.Breakdown, final.Score = rubric.ApplyBreakdown(result.Breakdown)
+		final.FullScore = rubric.Total()
+		final.FullScoreMismatch = !result.FullScore.Equal(final.FullScore)
+	case itemFullScore.Valid:
+		final.Score, final.FullScoreMismatch = Reconcile(result, itemFullScore.Decimal)
+		final.FullScore = itemFullScore.Decimal
+	default:
+		final.Score = result.Score
+		final.FullScore = result.FullScore
+	}
+	return final
+}
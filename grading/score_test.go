@@ -0,0 +1,54 @@
+package grading
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestReconcile(t *testing.T) {
+	ten := decimal.NewFromInt(10)
+	cases := []struct {
+		result       ScoreResult
+		wantScore    string
+		wantMismatch bool
+	}{
+		{ScoreResult{Score: decimal.NewFromInt(8), FullScore: ten}, "8", false},
+		{ScoreResult{Score: decimal.NewFromInt(4), FullScore: decimal.NewFromInt(5)}, "8", true},
+		{ScoreResult{Score: decimal.NewFromInt(15), FullScore: decimal.NewFromInt(15)}, "10", true},
+		{ScoreResult{Score: decimal.NewFromInt(3), FullScore: decimal.Zero}, "3", true},
+	}
+	for _, c := range cases {
+		score, mismatch := Reconcile(c.result, ten)
+		if score.String() != c.wantScore || mismatch != c.wantMismatch {
+			t.Errorf("Reconcile(%+v) = %s, %v; want %s, %v", c.result, score, mismatch, c.wantScore, c.wantMismatch)
+		}
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	output := GraderOutput{
+		Score:    decimal.NewFromInt(4),
+		MaxScore: decimal.NewFromInt(5),
+		Breakdown: []CriterionScore{
+			{CriterionID: "setup", Awarded: decimal.NewFromInt(2)},
+			{CriterionID: "solve", Awarded: decimal.NewFromInt(1)},
+		},
+	}
+	itemFull := decimal.NewNullDecimal(decimal.NewFromInt(6))
+
+	withRubric := Finalize(output, itemFull, testRubric())
+	if withRubric.Score.String() != "3" || withRubric.FullScore.String() != "6" || !withRubric.FullScoreMismatch || len(withRubric.Breakdown) != 3 {
+		t.Errorf("unexpected rubric result %+v", withRubric)
+	}
+
+	withoutRubric := Finalize(output, itemFull, Rubric{})
+	if withoutRubric.Score.String() != "4.8" || withoutRubric.FullScore.String() != "6" {
+		t.Errorf("unexpected reconciled result %+v", withoutRubric)
+	}
+
+	legacy := Finalize(output, decimal.NullDecimal{}, Rubric{})
+	if legacy.Score.String() != "4" || legacy.FullScore.String() != "5" || legacy.FullScoreMismatch {
+		t.Errorf("unexpected legacy result %+v", legacy)
+	}
+}
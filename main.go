@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
 	"examination-papers/configs"
 	"examination-papers/controllers"
 	"examination-papers/data/db"
 	"examination-papers/data/redis"
+	"examination-papers/data/storage"
+	"examination-papers/grading"
 	"examination-papers/middleware"
 	"examination-papers/routes"
+	"examination-papers/utils"
 	"log"
+	"os"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/shopspring/decimal"
 )
 
 func main() {
@@ -29,6 +36,8 @@ func main() {
 		DBName:   "unisudo-edu",
 		SSLMode:  "disable",
 	}
+	// 分数以 JSON 数字输出，而不是带引号的字符串
+	decimal.MarshalJSONWithoutQuotes = true
 	config := configs.FiberConfig()
 	app := fiber.New(config)
 	middleware.FiberMiddleware(app)
@@ -46,14 +55,38 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	examCase := controllers.NewSubmitExamCase(dbClient.DB, nil, redisClient.Client)
+	registry, err := grading.NewRegistryFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	// 配置了 MINIO_ENDPOINT 时作答图片在提交时转存到 MinIO
+	var minioClient *storage.MinioClient
+	if minioConfig, ok := storage.MinioConfigFromEnv(); ok {
+		minioClient, err = storage.NewMinioClient(minioConfig)
+		if err != nil {
+			panic(err)
+		}
+		// 直传的作答图片在提交时已转存，UPLOAD_RETENTION_DAYS（默认 7 天）后自动清理
+		uploadRetentionDays, _ := strconv.Atoi(os.Getenv("UPLOAD_RETENTION_DAYS"))
+		if uploadRetentionDays <= 0 {
+			uploadRetentionDays = 7
+		}
+		if err := minioClient.ExpirePrefix(context.Background(), utils.UploadObjectPrefix, uploadRetentionDays); err != nil {
+			log.Printf("Failed to set upload retention: %v", err)
+		}
+	}
+	examCase := controllers.NewSubmitExamCase(dbClient.DB, minioClient, redisClient.Client, registry)
 	for i := 0; i < 7; i++ { // 启动 5 个 worker
 		go examCase.SubmitExamWorker()
 	}
 	for i := 0; i < 5; i++ {
 		go examCase.SubmitAnswerWorker()
 	}
+	go examCase.OutboxRelay()
+	go examCase.ParkedTaskSweeper()
+	go examCase.ArchiveRetentionSweeper()
 	routes.PublicRoutes(app, examCase)
+	routes.PrivateRoutes(app, examCase)
 	serveURL := "127.0.0.1:8080"
 	log.Printf("Starting server on port %s", serveURL)
 	err = app.Listen(serveURL)
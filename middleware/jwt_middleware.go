@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 
 	jwtMiddleware "github.com/gofiber/contrib/jwt"
 )
@@ -21,6 +22,18 @@ func JWTProtected() func(*fiber.Ctx) error {
 	return jwtMiddleware.New(config)
 }
 
+// JWTOptional 携带 Authorization 头时校验 JWT，未携带时放行，由业务按未认证处理（如租户为空）
+func JWTOptional() func(*fiber.Ctx) error {
+	config := jwtMiddleware.Config{
+		Filter:       func(c *fiber.Ctx) bool { return c.Get(fiber.HeaderAuthorization) == "" },
+		SigningKey:   jwtMiddleware.SigningKey{Key: []byte(os.Getenv("JWT_SECRET_KEY"))},
+		ContextKey:   "jwt",
+		ErrorHandler: jwtError,
+	}
+
+	return jwtMiddleware.New(config)
+}
+
 func jwtError(c *fiber.Ctx, err error) error {
 	// Return status 401 and failed authentication error.
 	if err.Error() == "Missing or malformed JWT" {
@@ -36,3 +49,17 @@ func jwtError(c *fiber.Ctx, err error) error {
 		"msg":   err.Error(),
 	})
 }
+
+// TokenClaim 返回 JWTProtected 校验通过的 token 中的字符串 claim，未认证或不存在时返回空串
+func TokenClaim(c *fiber.Ctx, name string) string {
+	token, ok := c.Locals("jwt").(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	value, _ := claims[name].(string)
+	return value
+}
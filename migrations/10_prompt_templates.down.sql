@@ -0,0 +1,6 @@
+ALTER TABLE exam_blocks
+    DROP COLUMN prompt_version,
+    DROP COLUMN prompt_template_id;
+
+DROP TABLE exam_prompt_pins;
+DROP TABLE prompt_templates;
@@ -0,0 +1,22 @@
+-- Versioned grading prompts, one series of versions per subject
+CREATE TABLE prompt_templates (
+    id BIGSERIAL PRIMARY KEY,
+    subject TEXT NOT NULL,
+    version INT NOT NULL,
+    body TEXT NOT NULL,                 -- Go text/template over grading task fields
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (subject, version)
+);
+
+-- Exams pinned to a specific prompt version per subject
+CREATE TABLE exam_prompt_pins (
+    exam_id TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    prompt_template_id BIGINT NOT NULL REFERENCES prompt_templates (id),
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (exam_id, subject)
+);
+
+ALTER TABLE exam_blocks
+    ADD COLUMN prompt_template_id BIGINT REFERENCES prompt_templates (id), -- NULL when the profile prompt was used
+    ADD COLUMN prompt_version INT;
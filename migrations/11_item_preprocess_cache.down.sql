@@ -0,0 +1,4 @@
+ALTER TABLE exam_items
+    DROP COLUMN content_hash;
+
+DROP TABLE item_preprocess_cache;
@@ -0,0 +1,16 @@
+-- Preprocessing results keyed by a hash of the item content and the exam_item pipeline
+CREATE TABLE item_preprocess_cache (
+    content_hash TEXT PRIMARY KEY,
+    body_result TEXT NOT NULL,
+    correct_answer_result TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TRIGGER set_updated_at_item_preprocess_cache
+    BEFORE UPDATE ON item_preprocess_cache
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+ALTER TABLE exam_items
+    ADD COLUMN content_hash TEXT; -- Hash the preprocessing results were produced or reused for
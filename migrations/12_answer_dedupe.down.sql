@@ -0,0 +1,7 @@
+DROP INDEX idx_exam_blocks_grading_key;
+
+ALTER TABLE exam_blocks
+    DROP COLUMN cache_source_block_id,
+    DROP COLUMN cache_hit,
+    DROP COLUMN grading_key,
+    DROP COLUMN image_hashes;
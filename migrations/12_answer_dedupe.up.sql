@@ -0,0 +1,7 @@
+ALTER TABLE exam_blocks
+    ADD COLUMN image_hashes TEXT[],                    -- sha256 of each answer image that was graded
+    ADD COLUMN grading_key TEXT,                       -- Hash of every input that determines the grading result
+    ADD COLUMN cache_hit BOOLEAN NOT NULL DEFAULT FALSE, -- Result was copied from an earlier identical block
+    ADD COLUMN cache_source_block_id TEXT;             -- Block the result was copied from
+
+CREATE INDEX idx_exam_blocks_grading_key ON exam_blocks (grading_key) WHERE status = 'true';
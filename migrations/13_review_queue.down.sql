@@ -0,0 +1,10 @@
+DROP TABLE block_overrides;
+
+DROP INDEX idx_exam_blocks_review_status;
+
+ALTER TABLE exam_blocks
+    DROP COLUMN review_claimed_at,
+    DROP COLUMN review_claimed_by,
+    DROP COLUMN review_reasons,
+    DROP COLUMN review_status,
+    DROP COLUMN tenant_id;
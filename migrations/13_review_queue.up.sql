@@ -0,0 +1,24 @@
+ALTER TABLE exam_blocks
+    ADD COLUMN tenant_id TEXT,            -- Tenant used for URL policy checks on later callbacks
+    ADD COLUMN review_status TEXT,        -- pending / claimed / resolved, NULL when no review is needed
+    ADD COLUMN review_reasons TEXT[],     -- Why the block was flagged, e.g. failed / low_confidence
+    ADD COLUMN review_claimed_by TEXT,
+    ADD COLUMN review_claimed_at TIMESTAMP;
+
+CREATE INDEX idx_exam_blocks_review_status ON exam_blocks (review_status) WHERE review_status IN ('pending', 'claimed');
+
+-- Audit trail of manual score / feedback overrides
+CREATE TABLE block_overrides (
+    id BIGSERIAL PRIMARY KEY,
+    block_id TEXT NOT NULL REFERENCES exam_blocks (block_id),
+    reviewer TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    previous_status TEXT,
+    previous_score NUMERIC(8, 2),
+    previous_result TEXT,
+    score NUMERIC(8, 2),
+    result TEXT,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_block_overrides_block_id ON block_overrides (block_id);
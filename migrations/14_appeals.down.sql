@@ -0,0 +1,2 @@
+DROP TABLE grading_attempts;
+DROP TABLE appeals;
@@ -0,0 +1,43 @@
+-- Requests to regrade a single block
+CREATE TABLE appeals (
+    id BIGSERIAL PRIMARY KEY,
+    block_id TEXT NOT NULL REFERENCES exam_blocks (block_id),
+    requested_by TEXT,
+    reason TEXT NOT NULL,
+    app_id TEXT,                          -- Grading app to use instead of the subject profile's
+    pipeline TEXT,                        -- Pipeline to use instead of the profile's
+    prompt_version INT,                   -- Prompt template version to use instead of the exam's
+    status TEXT NOT NULL DEFAULT 'pending', -- pending / completed / failed
+    previous_score NUMERIC(8, 2),
+    score NUMERIC(8, 2),
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_appeals_block_id ON appeals (block_id);
+
+CREATE TRIGGER set_updated_at_appeals
+    BEFORE UPDATE ON appeals
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Snapshot of the block after every grading attempt, kept when the block is regraded
+CREATE TABLE grading_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    block_id TEXT NOT NULL REFERENCES exam_blocks (block_id),
+    submit_id TEXT,
+    trigger TEXT NOT NULL,                -- submit / appeal / review
+    appeal_id BIGINT REFERENCES appeals (id),
+    status TEXT,
+    score NUMERIC(8, 2),
+    full_score NUMERIC(8, 2),
+    result TEXT,
+    grader TEXT,
+    pipeline TEXT,
+    prompt_template_id BIGINT,
+    prompt_version INT,
+    grader_output JSONB,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_grading_attempts_block_id ON grading_attempts (block_id);
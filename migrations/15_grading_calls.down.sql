@@ -0,0 +1,5 @@
+DROP TABLE grading_calls;
+
+ALTER TABLE grading_attempts
+    DROP COLUMN error,
+    DROP COLUMN latency_ms;
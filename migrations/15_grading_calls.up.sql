@@ -0,0 +1,25 @@
+ALTER TABLE grading_attempts
+    ADD COLUMN latency_ms INT, -- Wall time of the whole grading pipeline
+    ADD COLUMN error TEXT;     -- Why the pipeline failed, NULL on success
+
+-- Every agent call made during a grading attempt, including retries
+CREATE TABLE grading_calls (
+    id BIGSERIAL PRIMARY KEY,
+    attempt_id BIGINT NOT NULL REFERENCES grading_attempts (id) ON DELETE CASCADE,
+    stage TEXT NOT NULL,
+    call_no INT NOT NULL,
+    provider TEXT NOT NULL,
+    app_id TEXT,
+    request_id TEXT,
+    session_id TEXT,
+    prompt TEXT,
+    params JSONB,
+    raw_output TEXT,
+    parsed_score NUMERIC(8, 2),
+    max_score NUMERIC(8, 2),
+    latency_ms INT,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_grading_calls_attempt_id ON grading_calls (attempt_id);
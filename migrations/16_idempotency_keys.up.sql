@@ -0,0 +1,11 @@
+-- Responses of submissions, replayed when a client retries with the same Idempotency-Key
+CREATE TABLE idempotency_keys (
+    tenant_id TEXT NOT NULL DEFAULT '',
+    endpoint TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,   -- Header value, or natural:<request hash> when the header is absent
+    request_hash TEXT NOT NULL,
+    status_code INT,                 -- NULL while the first request is still being processed
+    response JSONB,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, endpoint, idempotency_key)
+);
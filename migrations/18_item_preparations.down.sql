@@ -0,0 +1,2 @@
+DROP TABLE parked_answer_tasks;
+DROP TABLE item_preparations;
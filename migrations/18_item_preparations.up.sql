@@ -0,0 +1,26 @@
+-- Preprocessing state of each submitted item; answers wait until their item is ready
+CREATE TABLE item_preparations (
+    item_id TEXT PRIMARY KEY,
+    exam_id TEXT NOT NULL,
+    submit_id TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'preparing', -- preparing / ready / failed
+    error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TRIGGER set_updated_at_item_preparations
+    BEFORE UPDATE ON item_preparations
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Answer tasks parked until their item finishes preprocessing
+CREATE TABLE parked_answer_tasks (
+    id BIGSERIAL PRIMARY KEY,
+    item_id TEXT NOT NULL,
+    block_id TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    parked_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_parked_answer_tasks_item_id ON parked_answer_tasks (item_id);
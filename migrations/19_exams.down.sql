@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_item_preparations_exam_id;
+DROP TABLE exams;
@@ -0,0 +1,18 @@
+-- One row per exam (card); tracks the latest submission through preprocessing
+CREATE TABLE exams (
+    exam_id TEXT PRIMARY KEY,
+    submit_id TEXT NOT NULL,
+    tenant_id TEXT,
+    callback TEXT,
+    status TEXT NOT NULL DEFAULT 'received', -- received / preprocessing / ready / partially_failed / failed
+    item_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TRIGGER set_updated_at_exams
+    BEFORE UPDATE ON exams
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+CREATE INDEX idx_item_preparations_exam_id ON item_preparations (exam_id, submit_id);
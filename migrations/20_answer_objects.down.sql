@@ -0,0 +1 @@
+ALTER TABLE exam_blocks DROP COLUMN answer_objects;
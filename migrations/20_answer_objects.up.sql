@@ -0,0 +1,2 @@
+-- MinIO keys of the answer images copied at submission time, same order as answer
+ALTER TABLE exam_blocks ADD COLUMN answer_objects TEXT[];
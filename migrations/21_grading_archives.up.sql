@@ -0,0 +1,14 @@
+-- Grading bundles archived to object storage, one per grading attempt
+CREATE TABLE grading_archives (
+    id BIGSERIAL PRIMARY KEY,
+    block_id TEXT NOT NULL REFERENCES exam_blocks (block_id),
+    attempt_id BIGINT NOT NULL UNIQUE REFERENCES grading_attempts (id),
+    tenant_id TEXT,
+    object_prefix TEXT NOT NULL, -- bundle.json and assets/ live under this prefix
+    created_at TIMESTAMP DEFAULT NOW(),
+    expires_at TIMESTAMP,        -- NULL keeps the bundle forever
+    deleted_at TIMESTAMP         -- Set once the retention sweeper removed the objects
+);
+
+CREATE INDEX idx_grading_archives_block_id ON grading_archives (block_id);
+CREATE INDEX idx_grading_archives_expires_at ON grading_archives (expires_at) WHERE deleted_at IS NULL;
@@ -0,0 +1 @@
+DROP TABLE exam_layouts;
@@ -0,0 +1,12 @@
+-- Answer sheet layout of an exam: which scanned page / region belongs to which item
+CREATE TABLE exam_layouts (
+    exam_id TEXT PRIMARY KEY,
+    layout JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TRIGGER set_updated_at_exam_layouts
+    BEFORE UPDATE ON exam_layouts
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
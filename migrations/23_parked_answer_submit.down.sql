@@ -0,0 +1 @@
+ALTER TABLE parked_answer_tasks DROP COLUMN submit_id;
@@ -0,0 +1,6 @@
+-- Submission whose preprocessing a parked answer is waiting for; only that submission may release it
+ALTER TABLE parked_answer_tasks ADD COLUMN submit_id TEXT NOT NULL DEFAULT '';
+
+UPDATE parked_answer_tasks p SET submit_id = i.submit_id
+FROM item_preparations i
+WHERE p.item_id = i.item_id;
@@ -0,0 +1,2 @@
+DROP INDEX idx_prompt_templates_active;
+ALTER TABLE prompt_templates DROP COLUMN active;
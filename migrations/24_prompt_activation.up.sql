@@ -0,0 +1,8 @@
+-- Only an explicitly activated version is used for exams without a pin
+ALTER TABLE prompt_templates ADD COLUMN active BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Keep the version that is in effect today: the newest one per subject
+UPDATE prompt_templates t SET active = TRUE
+WHERE t.version = (SELECT MAX(version) FROM prompt_templates WHERE subject = t.subject);
+
+CREATE UNIQUE INDEX idx_prompt_templates_active ON prompt_templates (subject) WHERE active;
@@ -0,0 +1,6 @@
+ALTER TABLE exam_blocks
+    DROP CONSTRAINT IF EXISTS exam_blocks_score_range;
+
+ALTER TABLE exam_blocks
+    ALTER COLUMN score TYPE TEXT USING COALESCE(score::TEXT, '0'),
+    ALTER COLUMN full_score TYPE TEXT USING COALESCE(full_score::TEXT, '0');
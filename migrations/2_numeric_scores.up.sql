@@ -0,0 +1,16 @@
+-- Convert text scores to numeric; failed or non-numeric scores become NULL ("not scored")
+ALTER TABLE exam_blocks
+    ALTER COLUMN score TYPE NUMERIC(8, 2) USING (
+        CASE WHEN status <> 'failed' AND score ~ '^\s*[0-9]+(\.[0-9]+)?\s*$' THEN trim(score)::NUMERIC END
+    ),
+    ALTER COLUMN full_score TYPE NUMERIC(8, 2) USING (
+        CASE WHEN status <> 'failed' AND full_score ~ '^\s*[0-9]+(\.[0-9]+)?\s*$' THEN trim(full_score)::NUMERIC END
+    );
+
+-- Drop scores that violate the range check before adding it
+UPDATE exam_blocks SET score = NULL WHERE score > full_score;
+
+ALTER TABLE exam_blocks
+    ADD CONSTRAINT exam_blocks_score_range CHECK (
+        score IS NULL OR (score >= 0 AND (full_score IS NULL OR score <= full_score))
+    );
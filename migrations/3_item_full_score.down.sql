@@ -0,0 +1,6 @@
+ALTER TABLE exam_blocks
+    DROP COLUMN model_full_score,
+    DROP COLUMN full_score_mismatch;
+
+ALTER TABLE exam_items
+    DROP COLUMN full_score;
@@ -0,0 +1,6 @@
+ALTER TABLE exam_items
+    ADD COLUMN full_score NUMERIC(8, 2); -- Full score submitted with the item, authoritative for grading
+
+ALTER TABLE exam_blocks
+    ADD COLUMN model_full_score NUMERIC(8, 2),                    -- Full score reported by the scoring agent
+    ADD COLUMN full_score_mismatch BOOLEAN NOT NULL DEFAULT FALSE; -- Model disagreed with the item's full score
@@ -0,0 +1,2 @@
+ALTER TABLE exam_blocks
+    ADD COLUMN graded_answers TEXT[]; -- Answer image URLs that were actually sent to the grader
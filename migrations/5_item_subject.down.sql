@@ -0,0 +1,2 @@
+ALTER TABLE exam_items
+    DROP COLUMN subject;
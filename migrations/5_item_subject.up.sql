@@ -0,0 +1,2 @@
+ALTER TABLE exam_items
+    ADD COLUMN subject TEXT NOT NULL DEFAULT 'math'; -- Subject used to route grading, existing items were graded as math
@@ -0,0 +1,7 @@
+ALTER TABLE exam_blocks
+    DROP COLUMN answer_text,
+    DROP COLUMN grader;
+
+ALTER TABLE exam_items
+    DROP COLUMN question_type,
+    DROP COLUMN tolerance;
@@ -0,0 +1,7 @@
+ALTER TABLE exam_items
+    ADD COLUMN question_type TEXT NOT NULL DEFAULT 'open', -- single_choice, multiple_choice, true_false, numeric or open
+    ADD COLUMN tolerance DOUBLE PRECISION NOT NULL DEFAULT 0; -- Absolute tolerance for numeric questions
+
+ALTER TABLE exam_blocks
+    ADD COLUMN answer_text TEXT,  -- Recognized answer text submitted with the block
+    ADD COLUMN grader TEXT;       -- local for deterministic grading, llm for agent grading
@@ -0,0 +1,5 @@
+ALTER TABLE exam_blocks
+    DROP COLUMN score_breakdown;
+
+ALTER TABLE exam_items
+    DROP COLUMN rubric;
@@ -0,0 +1,5 @@
+ALTER TABLE exam_items
+    ADD COLUMN rubric JSONB; -- Structured scoring criteria, NULL when the item has none
+
+ALTER TABLE exam_blocks
+    ADD COLUMN score_breakdown JSONB; -- Per-criterion scores awarded by the grader
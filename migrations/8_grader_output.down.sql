@@ -0,0 +1,3 @@
+ALTER TABLE exam_blocks
+    DROP COLUMN grader_output,
+    DROP COLUMN confidence;
@@ -0,0 +1,3 @@
+ALTER TABLE exam_blocks
+    ADD COLUMN grader_output JSONB,        -- Schema-validated structured grader output
+    ADD COLUMN confidence NUMERIC(4, 3);   -- Grader confidence in [0, 1] when reported
@@ -0,0 +1,2 @@
+ALTER TABLE exam_blocks
+    DROP COLUMN pipeline_mode;
@@ -0,0 +1,2 @@
+ALTER TABLE exam_blocks
+    ADD COLUMN pipeline_mode TEXT; -- two_step or single_call, NULL for blocks graded locally
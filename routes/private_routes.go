@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"examination-papers/controllers"
+	"examination-papers/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+// PrivateRoutes func for describe group of private routes.
+func PrivateRoutes(a *fiber.App, sc *controllers.SubmitExamCase) {
+	// Create routes group.
+	route := a.Group("/api/v1")
+
+	// 复核接口需要 JWT，复核人取自 token 的 sub
+	route.Get("/reviews", middleware.JWTProtected(), sc.ListReviewsController)
+	route.Post("/reviews/:block_id/claim", middleware.JWTProtected(), sc.ClaimReviewController)
+	route.Post("/reviews/:block_id/override", middleware.JWTProtected(), sc.OverrideReviewController)
+	// 新增、启用与固定 prompt 版本会改变判卷结果，同样需要 JWT
+	route.Post("/prompt_templates", middleware.JWTProtected(), sc.CreatePromptTemplateController)
+	route.Put("/prompt_templates/active", middleware.JWTProtected(), sc.ActivatePromptController)
+	route.Put("/exams/:exam_id/prompt_pin", middleware.JWTProtected(), sc.PinPromptController)
+	// 直传与扫描件切分出的作答图片存放在 token 租户的目录下，需要带租户的 JWT
+	route.Post("/uploads", middleware.JWTProtected(), sc.UploadAnswerImagesController)
+	route.Post("/uploads/presign", middleware.JWTProtected(), sc.PresignUploadController)
+	route.Post("/exams/:exam_id/scans", middleware.JWTProtected(), sc.IngestScanController)
+	// 版面决定之后每份扫描件的切分方式
+	route.Put("/exams/:exam_id/layout", middleware.JWTProtected(), sc.PutExamLayoutController)
+	// 申诉会触发重判，按 token 的租户隔离
+	route.Post("/blocks/:block_id/appeals", middleware.JWTProtected(), sc.AppealController)
+	// 判卷历史包含每次智能体调用的参数与原始输出，按 token 的租户隔离
+	route.Get("/blocks/:block_id/attempts", middleware.JWTProtected(), sc.ListGradingAttemptsController)
+	// 判卷包含作答图片、完整 prompt 与模型原始输出，按 token 的租户隔离
+	route.Get("/blocks/:block_id/archive", middleware.JWTProtected(), sc.GetBlockArchiveController)
+}
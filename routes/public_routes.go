@@ -2,6 +2,7 @@ package routes
 
 import (
 	"examination-papers/controllers"
+	"examination-papers/middleware"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -12,6 +13,10 @@ func PublicRoutes(a *fiber.App, sc *controllers.SubmitExamCase) {
 
 	// Routes for GET method:
 	// route.Get("/books", controllers.GetBooks)   // get list of all books
-	route.Post("/submit_exam", sc.SubmitExamController)
-	route.Post("/submit_student_answer", sc.SubmitAnswerController)
+	// 提交接口的租户取自 JWT 的 tenant_id claim，不带 token 时按无租户处理
+	route.Post("/submit_exam", middleware.JWTOptional(), sc.SubmitExamController)
+	route.Post("/submit_student_answer", middleware.JWTOptional(), sc.SubmitAnswerController)
+	route.Get("/prompt_templates", sc.ListPromptTemplatesController)
+	route.Get("/exams/:card_id", sc.GetExamController)
+	route.Get("/exams/:exam_id/layout", sc.GetExamLayoutController)
 }
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +11,12 @@ import (
 	"os"
 )
 
+// DefaultAgentPrompt 是未指定 prompt 时发给智能体的默认指令
+const DefaultAgentPrompt = "好好批卷"
+
+// AgentProvider 是智能体调用的服务商，记入判卷历史
+const AgentProvider = "dashscope"
+
 type AgentResult struct {
 	SessionID    string `json:"session_id"`
 	FinishReason string `json:"finish_reason"`
@@ -99,11 +106,16 @@ func AgentMathScore(question, answer string) (*AgentResult, error) {
 }
 
 func RetryAgentRequest(appIdEnv string, bizParams map[string]interface{}, retries int) (*AgentResult, error) {
+	return RetryAgentRequestWithPrompt(appIdEnv, DefaultAgentPrompt, bizParams, retries)
+}
+
+// RetryAgentRequestWithPrompt 与 RetryAgentRequest 相同，但使用指定的 prompt
+func RetryAgentRequestWithPrompt(appIdEnv, prompt string, bizParams map[string]interface{}, retries int) (*AgentResult, error) {
 	var err error
 	var result *AgentResult
 
 	for i := 0; i < retries; i++ {
-		result, err = AgentRequest(appIdEnv, bizParams)
+		result, err = AgentRequestWithPrompt(appIdEnv, prompt, bizParams)
 		if err == nil {
 			return result, nil
 		}
@@ -114,6 +126,19 @@ func RetryAgentRequest(appIdEnv string, bizParams map[string]interface{}, retrie
 }
 
 func AgentRequest(appIdEnv string, bizParams map[string]interface{}) (*AgentResult, error) {
+	return AgentRequestWithPrompt(appIdEnv, DefaultAgentPrompt, bizParams)
+}
+
+// AgentRequestWithPrompt 调用百炼应用，prompt 为空时使用默认指令
+func AgentRequestWithPrompt(appIdEnv, prompt string, bizParams map[string]interface{}) (*AgentResult, error) {
+	return AgentRequestContext(context.Background(), appIdEnv, prompt, bizParams)
+}
+
+// AgentRequestContext 与 AgentRequestWithPrompt 相同，请求受 ctx 的超时与取消控制
+func AgentRequestContext(ctx context.Context, appIdEnv, prompt string, bizParams map[string]interface{}) (*AgentResult, error) {
+	if prompt == "" {
+		prompt = DefaultAgentPrompt
+	}
 	apiKey := os.Getenv("DASHSCOPE_API_KEY")
 
 	if apiKey == "" {
@@ -130,7 +155,7 @@ func AgentRequest(appIdEnv string, bizParams map[string]interface{}) (*AgentResu
 
 	requestBody := map[string]interface{}{
 		"input": map[string]interface{}{
-			"prompt":     "好好批卷",
+			"prompt":     prompt,
 			"biz_params": bizParams,
 		},
 		"parameters": map[string]interface{}{},
@@ -142,7 +167,7 @@ func AgentRequest(appIdEnv string, bizParams map[string]interface{}) (*AgentResu
 		return nil, fmt.Errorf("Failed to marshal JSON: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create request: %v", err)
 	}
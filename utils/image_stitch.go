@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+)
+
+// StitchImagesVertically 将多张图片按顺序纵向拼接为一张 JPEG，宽度取最宽的一张，空白处填充白色
+func StitchImagesVertically(images [][]byte) ([]byte, error) {
+	if len(images) == 0 {
+		return nil, errors.New("no images to stitch")
+	}
+	// 先只读取图片头部计算画布尺寸，超出像素上限时不解码、不分配画布
+	width, height := 0, 0
+	for i, data := range images {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decode image %d: %w", i, err)
+		}
+		if cfg.Width > width {
+			width = cfg.Width
+		}
+		height += cfg.Height
+	}
+	if width*height > maxScanImagePixels {
+		return nil, fmt.Errorf("stitched image of %dx%d pixels is too large", width, height)
+	}
+	decoded := make([]image.Image, 0, len(images))
+	for i, data := range images {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decode image %d: %w", i, err)
+		}
+		decoded = append(decoded, img)
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	y := 0
+	for _, img := range decoded {
+		bounds := img.Bounds()
+		draw.Draw(canvas, image.Rect(0, y, bounds.Dx(), y+bounds.Dy()), img, bounds.Min, draw.Over)
+		y += bounds.Dy()
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, fmt.Errorf("encode stitched image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,16 @@
+package utils
+
+import "testing"
+
+func TestStitchImagesVertically(t *testing.T) {
+	stitched, err := StitchImagesVertically([][]byte{testJPEG(t, 40, 30), testJPEG(t, 20, 10)})
+	if err != nil {
+		t.Fatalf("StitchImagesVertically: %v", err)
+	}
+	if w, h := imageSize(t, stitched); w != 40 || h != 40 {
+		t.Errorf("stitched image is %dx%d, want 40x40", w, h)
+	}
+	if _, err := StitchImagesVertically([][]byte{testJPEG(t, 1, 1), hugeJPEG(t)}); err == nil {
+		t.Error("expected an error for images with too many pixels")
+	}
+}
@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+var ErrUnsupportedPDF = errors.New("unsupported PDF")
+
+// maxScanImagePixels 限制单页图片解码后的像素数，A3 600dpi 约 7000x9900
+const maxScanImagePixels = 80_000_000
+
+var pdfDoOperator = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+Do\b`)
+
+func init() {
+	// 不读写 pdfcpu 的用户配置目录
+	api.DisableConfigDir()
+}
+
+// ExtractPDFPageImages 按页序取出扫描件 PDF 前 maxPages 页的整页图片（每页取面积最大的一张），maxPages <= 0 时不限，
+// 同时返回 PDF 的总页数。由 pdfcpu 解析，支持对象流与交叉引用流；JPEG 原样返回，其他编码的图片转为 PNG
+func ExtractPDFPageImages(data []byte, maxPages int) (images [][]byte, total int, err error) {
+	// pdfcpu 遇到部分损坏的文件会 panic，按不支持的 PDF 处理
+	defer func() {
+		if r := recover(); r != nil {
+			images, total, err = nil, 0, fmt.Errorf("%w: %v", ErrUnsupportedPDF, r)
+		}
+	}()
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return nil, 0, fmt.Errorf("%w: missing %%PDF header", ErrUnsupportedPDF)
+	}
+	conf := model.NewDefaultConfiguration()
+	conf.Cmd = model.EXTRACTIMAGES
+	ctx, err := api.ReadValidateAndOptimize(bytes.NewReader(data), conf)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrUnsupportedPDF, err)
+	}
+	total = ctx.PageCount
+	if total == 0 {
+		return nil, 0, fmt.Errorf("%w: no pages", ErrUnsupportedPDF)
+	}
+	pages := total
+	if maxPages > 0 && pages > maxPages {
+		pages = maxPages
+	}
+	images = make([][]byte, 0, pages)
+	for pageNr := 1; pageNr <= pages; pageNr++ {
+		img, err := pdfPageImage(ctx, pageNr)
+		if err != nil {
+			return nil, 0, fmt.Errorf("page %d: %w", pageNr, err)
+		}
+		images = append(images, img)
+	}
+	return images, total, nil
+}
+
+// pdfPageImage 取出页面中面积最大的图片。先按图片字典中的宽高检查像素数，再解码该图片
+func pdfPageImage(ctx *model.Context, pageNr int) ([]byte, error) {
+	stubs, err := pdfcpu.ExtractPageImages(ctx, pageNr, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedPDF, err)
+	}
+	// 资源字典可能由多页共用或继承自页树，只考虑页面内容实际绘制的图片；
+	// 图片画在表单对象中等情况找不到时退回资源中的全部图片
+	drawn, err := pdfDrawnNames(ctx, pageNr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedPDF, err)
+	}
+	anyDrawn := false
+	for _, stub := range stubs {
+		anyDrawn = anyDrawn || drawn[stub.Name]
+	}
+	best, bestArea := 0, -1
+	for objNr, stub := range stubs {
+		if stub.Thumb || stub.IsImgMask || (anyDrawn && !drawn[stub.Name]) {
+			continue
+		}
+		// 面积相同时取对象号较小的，结果与 map 遍历顺序无关
+		if area := stub.Width * stub.Height; area > bestArea || (area == bestArea && objNr < best) {
+			best, bestArea = objNr, area
+		}
+	}
+	if bestArea < 0 {
+		return nil, fmt.Errorf("%w: page has no image", ErrUnsupportedPDF)
+	}
+	if bestArea > maxScanImagePixels {
+		return nil, fmt.Errorf("%w: image of %dx%d pixels is too large", ErrUnsupportedPDF, stubs[best].Width, stubs[best].Height)
+	}
+	img, err := pdfcpu.ExtractImage(ctx, ctx.Optimize.ImageObjects[best].ImageDict, false, stubs[best].Name, best, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedPDF, err)
+	}
+	if img == nil || img.Reader == nil || (img.FileType != "jpg" && img.FileType != "png") {
+		return nil, fmt.Errorf("%w: image filter %q", ErrUnsupportedPDF, stubs[best].Filter)
+	}
+	data, err := io.ReadAll(img)
+	if err != nil {
+		return nil, fmt.Errorf("read page image: %w", err)
+	}
+	// JPEG 头部声明的尺寸可能与图片字典不一致
+	if err := checkImagePixels(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// pdfDrawnNames 返回页面内容流中以 Do 绘制的 XObject 资源名
+func pdfDrawnNames(ctx *model.Context, pageNr int) (map[string]bool, error) {
+	content, err := pdfcpu.ExtractPageContent(ctx, pageNr)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, m := range pdfDoOperator.FindAllSubmatch(data, -1) {
+		names[string(m[1])] = true
+	}
+	return names, nil
+}
+
+// ZipLimits 限制解压 ZIP 时的资源占用
+type ZipLimits struct {
+	MaxEntries    int   // ZIP 中的条目数
+	MaxFileBytes  int64 // 单个文件解压后的大小
+	MaxTotalBytes int64 // 读取的全部文件解压后的总大小
+	MaxPages      int   // 只取前 MaxPages 张图片，<= 0 时不限
+}
+
+// ExtractZipImages 取出 ZIP 中的图片，按文件名排序作为页序（页码需补零，如 page01.jpg），同时返回图片总数。
+// 忽略目录、隐藏文件和非图片文件；超出 MaxPages 的图片只读取文件头用于计数
+func ExtractZipImages(data []byte, limits ZipLimits) ([][]byte, int, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("open zip: %w", err)
+	}
+	if len(reader.File) > limits.MaxEntries {
+		return nil, 0, fmt.Errorf("zip has more than %d entries", limits.MaxEntries)
+	}
+	files := make([]*zip.File, 0, len(reader.File))
+	for _, file := range reader.File {
+		name := path.Base(file.Name)
+		if file.FileInfo().IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(file.Name, "__MACOSX/") {
+			continue
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	var images [][]byte
+	var total int
+	var totalBytes int64
+	for _, file := range files {
+		if file.UncompressedSize64 > uint64(limits.MaxFileBytes) {
+			return nil, 0, fmt.Errorf("%s exceeds %d bytes", file.Name, limits.MaxFileBytes)
+		}
+		// 已取满页数时只读取识别类型所需的文件头
+		readLimit := limits.MaxFileBytes + 1
+		full := limits.MaxPages <= 0 || len(images) < limits.MaxPages
+		if !full {
+			readLimit = 512
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, 0, fmt.Errorf("open %s: %w", file.Name, err)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, readLimit))
+		rc.Close()
+		if err != nil {
+			return nil, 0, fmt.Errorf("read %s: %w", file.Name, err)
+		}
+		if int64(len(content)) > limits.MaxFileBytes {
+			return nil, 0, fmt.Errorf("%s exceeds %d bytes", file.Name, limits.MaxFileBytes)
+		}
+		totalBytes += int64(len(content))
+		if totalBytes > limits.MaxTotalBytes {
+			return nil, 0, fmt.Errorf("zip content exceeds %d bytes", limits.MaxTotalBytes)
+		}
+		if !strings.HasPrefix(http.DetectContentType(content), "image/") {
+			continue
+		}
+		total++
+		if full {
+			images = append(images, content)
+		}
+	}
+	if len(images) == 0 {
+		return nil, 0, errors.New("zip contains no images")
+	}
+	return images, total, nil
+}
+
+// checkImagePixels 只读取图片头部，拒绝解码后像素数超出限制的图片
+func checkImagePixels(data []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("decode image: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxScanImagePixels {
+		return fmt.Errorf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+// DecodeScanImage 解码扫描页图片，先按图片头部检查像素数。同一页裁剪多个区域时只需解码一次
+func DecodeScanImage(data []byte) (image.Image, error) {
+	if err := checkImagePixels(data); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	return img, nil
+}
+
+// CropImage 按相对坐标（0-1）裁剪已解码的图片，输出 JPEG
+func CropImage(img image.Image, x, y, width, height float64) ([]byte, error) {
+	bounds := img.Bounds()
+	rect := image.Rect(
+		bounds.Min.X+int(x*float64(bounds.Dx())),
+		bounds.Min.Y+int(y*float64(bounds.Dy())),
+		bounds.Min.X+int((x+width)*float64(bounds.Dx())),
+		bounds.Min.Y+int((y+height)*float64(bounds.Dy())),
+	).Intersect(bounds)
+	if rect.Empty() {
+		return nil, errors.New("crop region is empty")
+	}
+	cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, cropped, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, fmt.Errorf("encode cropped image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+func testJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// hugeJPEG 改写 JPEG 的 SOF0 头部，声明 20000x20000 像素而不实际分配
+func hugeJPEG(t *testing.T) []byte {
+	t.Helper()
+	data := testJPEG(t, 1, 1)
+	sof := bytes.Index(data, []byte{0xff, 0xc0})
+	if sof < 0 {
+		t.Fatal("SOF0 marker not found")
+	}
+	copy(data[sof+5:], []byte{0x4e, 0x20, 0x4e, 0x20})
+	return data
+}
+
+func imageSize(t *testing.T, data []byte) (int, int) {
+	t.Helper()
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode image: %v", err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+// testPDF 构造两页的扫描件：/Kids 顺序与对象顺序相反，第一页为灰度 FlateDecode，第二页为 JPEG 且资源继承自页树。
+// 页树的资源同时对第一页可见，第一页需按内容流实际绘制的图片选择
+func testPDF(t *testing.T) []byte {
+	t.Helper()
+	var gray bytes.Buffer
+	w := zlib.NewWriter(&gray)
+	w.Write([]byte{0, 50, 100, 150, 200, 250})
+	w.Close()
+	jpg := testJPEG(t, 4, 2)
+
+	var pdf bytes.Buffer
+	var offsets []int
+	object := func(format string, args ...interface{}) {
+		offsets = append(offsets, pdf.Len())
+		fmt.Fprintf(&pdf, "%d 0 obj\n"+format+"\nendobj\n", append([]interface{}{len(offsets)}, args...)...)
+	}
+	pdf.WriteString("%PDF-1.4\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object("<< /Type /Pages /Kids [5 0 R 3 0 R] /Count 2 /MediaBox [0 0 4 2] /Resources << /XObject << /Im1 4 0 R >> >> >>")
+	object("<< /Type /Page /Parent 2 0 R /Contents 9 0 R >>")
+	object("<< /Type /XObject /Subtype /Image /Width 4 /Height 2 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n%s\nendstream", len(jpg), jpg)
+	object("<< /Type /Page /Parent 2 0 R /Resources 6 0 R /Contents 10 0 R >>")
+	object("<< /XObject << /Im0 7 0 R >> >>")
+	object("<< /Type /XObject /Subtype /Image /Width 3 /Height 2 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode /Length 8 0 R >>\nstream\n%s\nendstream", gray.Bytes())
+	object("%d", gray.Len())
+	object("<< /Length 26 >>\nstream\nq 4 0 0 2 0 0 cm /Im1 Do Q\nendstream")
+	object("<< /Length 26 >>\nstream\nq 3 0 0 2 0 0 cm /Im0 Do Q\nendstream")
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return pdf.Bytes()
+}
+
+// checkTestPDFPages 校验从 testPDF 取出的两页图片
+func checkTestPDFPages(t *testing.T, data []byte) {
+	t.Helper()
+	pages, total, err := ExtractPDFPageImages(data, 0)
+	if err != nil {
+		t.Fatalf("ExtractPDFPageImages: %v", err)
+	}
+	if len(pages) != 2 || total != 2 {
+		t.Fatalf("got %d of %d pages, want 2", len(pages), total)
+	}
+	first, err := png.Decode(bytes.NewReader(pages[0]))
+	if err != nil {
+		t.Fatalf("first page is not a PNG: %v", err)
+	}
+	if first.Bounds().Dx() != 3 || first.Bounds().Dy() != 2 {
+		t.Errorf("first page is %v, want 3x2", first.Bounds())
+	}
+	if r, _, _, _ := first.At(2, 1).RGBA(); r>>8 != 250 {
+		t.Errorf("unexpected pixel value %d", r>>8)
+	}
+	if w, h := imageSize(t, pages[1]); w != 4 || h != 2 {
+		t.Errorf("second page is %dx%d, want 4x2", w, h)
+	}
+}
+
+func TestExtractPDFPageImages(t *testing.T) {
+	checkTestPDFPages(t, testPDF(t))
+
+	pages, total, err := ExtractPDFPageImages(testPDF(t), 1)
+	if err != nil {
+		t.Fatalf("ExtractPDFPageImages: %v", err)
+	}
+	if len(pages) != 1 || total != 2 {
+		t.Errorf("got %d of %d pages, want 1 of 2", len(pages), total)
+	}
+}
+
+// PDF 1.5 起扫描仪常把对象放在对象流中、用交叉引用流代替 xref 表
+func TestExtractPDFPageImagesObjectStreams(t *testing.T) {
+	conf := model.NewDefaultConfiguration()
+	conf.WriteObjectStream = true
+	conf.WriteXRefStream = true
+	var out bytes.Buffer
+	if err := api.Optimize(bytes.NewReader(testPDF(t)), &out, conf); err != nil {
+		t.Fatalf("rewrite with object streams: %v", err)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("/ObjStm")) || !bytes.Contains(out.Bytes(), []byte("/XRef")) {
+		t.Fatal("rewritten PDF has no object or xref streams")
+	}
+	checkTestPDFPages(t, out.Bytes())
+}
+
+func TestExtractPDFPageImagesUnsupported(t *testing.T) {
+	for _, pdf := range [][]byte{
+		[]byte("not a pdf"),
+		[]byte("%PDF-1.5\n1 0 obj\n<< /Type /ObjStm /N 2 /First 10 /Length 0 >>\nstream\n\nendstream\nendobj\n"),
+	} {
+		if _, _, err := ExtractPDFPageImages(pdf, 0); !errors.Is(err, ErrUnsupportedPDF) {
+			t.Errorf("expected ErrUnsupportedPDF, got %v", err)
+		}
+	}
+}
+
+func TestExtractZipImages(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{"page02.jpg", testJPEG(t, 2, 2)},
+		{"notes.txt", []byte("not an image")},
+		{"__MACOSX/._page01.jpg", []byte("resource fork")},
+		{"page01.jpg", testJPEG(t, 1, 1)},
+	} {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(f.data)
+	}
+	zw.Close()
+
+	limits := ZipLimits{MaxEntries: 10, MaxFileBytes: 1 << 20, MaxTotalBytes: 4 << 20}
+	images, total, err := ExtractZipImages(buf.Bytes(), limits)
+	if err != nil {
+		t.Fatalf("ExtractZipImages: %v", err)
+	}
+	if len(images) != 2 || total != 2 {
+		t.Fatalf("got %d of %d images, want 2", len(images), total)
+	}
+	if w, _ := imageSize(t, images[0]); w != 1 {
+		t.Errorf("images are not sorted by file name")
+	}
+
+	limits.MaxPages = 1
+	if images, total, err = ExtractZipImages(buf.Bytes(), limits); err != nil || len(images) != 1 || total != 2 {
+		t.Errorf("got %d of %d images (%v), want 1 of 2", len(images), total, err)
+	}
+	for _, limits := range []ZipLimits{
+		{MaxEntries: 3, MaxFileBytes: 1 << 20, MaxTotalBytes: 4 << 20},
+		{MaxEntries: 10, MaxFileBytes: 1 << 20, MaxTotalBytes: 100},
+	} {
+		if _, _, err := ExtractZipImages(buf.Bytes(), limits); err == nil {
+			t.Errorf("expected an error for limits %+v", limits)
+		}
+	}
+}
+
+func TestCropImage(t *testing.T) {
+	page, err := DecodeScanImage(testJPEG(t, 100, 40))
+	if err != nil {
+		t.Fatalf("DecodeScanImage: %v", err)
+	}
+	cropped, err := CropImage(page, 0.5, 0.25, 0.5, 0.5)
+	if err != nil {
+		t.Fatalf("CropImage: %v", err)
+	}
+	if w, h := imageSize(t, cropped); w != 50 || h != 20 {
+		t.Errorf("cropped image is %dx%d, want 50x20", w, h)
+	}
+	if _, err := CropImage(page, 1, 1, 0.5, 0.5); err == nil {
+		t.Error("expected an error for a region outside the image")
+	}
+	if _, err := DecodeScanImage(hugeJPEG(t)); err == nil {
+		t.Error("expected an error for an image with too many pixels")
+	}
+}
@@ -0,0 +1,281 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrURLScheme        = errors.New("url scheme is not allowed")
+	ErrURLHost          = errors.New("url host is not allowed")
+	ErrURLTenant        = errors.New("tenant has no allowed hosts")
+	ErrURLPrivateAddr   = errors.New("url resolves to a private or loopback address")
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrBodyTooLarge     = errors.New("body exceeds size limit")
+)
+
+// URLPolicy 对用户提交的 URL（回调地址、作答图片）做 SSRF 防护校验
+type URLPolicy struct {
+	AllowedSchemes []string            // 允许的协议，如 https
+	TenantHosts    map[string][]string // 租户 -> 允许的 host 列表；配置后未列出的租户（含空租户）一律拒绝
+	AllowPrivate   bool                // 是否允许解析到内网地址（仅本地调试使用）
+	MaxRedirects   int                 // 最多跟随的重定向次数
+	MaxBodyBytes   int64               // 请求体 / 响应体大小上限
+	Timeout        time.Duration       // 单次请求超时时间
+}
+
+// NewURLPolicyFromEnv 从环境变量构造 URL 策略
+//
+//	URL_ALLOWED_SCHEMES  逗号分隔，默认 https,http
+//	URL_TENANT_HOSTS     形如 tenantA=a.com|*.b.com;tenantB=c.com
+//	URL_ALLOW_PRIVATE    true 时不拦截内网地址
+//	URL_MAX_REDIRECTS    默认 3
+//	URL_MAX_BODY_BYTES   默认 10MB
+//	URL_TIMEOUT_SECONDS  默认 30
+func NewURLPolicyFromEnv() *URLPolicy {
+	policy := &URLPolicy{
+		AllowedSchemes: []string{"https", "http"},
+		TenantHosts:    map[string][]string{},
+		MaxRedirects:   3,
+		MaxBodyBytes:   10 << 20,
+		Timeout:        30 * time.Second,
+	}
+	if v := os.Getenv("URL_ALLOWED_SCHEMES"); v != "" {
+		policy.AllowedSchemes = splitAndTrim(v, ",")
+	}
+	if v := os.Getenv("URL_TENANT_HOSTS"); v != "" {
+		policy.TenantHosts = ParseTenantHosts(v)
+	}
+	policy.AllowPrivate, _ = strconv.ParseBool(os.Getenv("URL_ALLOW_PRIVATE"))
+	if v, err := strconv.Atoi(os.Getenv("URL_MAX_REDIRECTS")); err == nil && v >= 0 {
+		policy.MaxRedirects = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("URL_MAX_BODY_BYTES"), 10, 64); err == nil && v > 0 {
+		policy.MaxBodyBytes = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("URL_TIMEOUT_SECONDS")); err == nil && v > 0 {
+		policy.Timeout = time.Duration(v) * time.Second
+	}
+	return policy
+}
+
+// ParseTenantHosts 解析 tenantA=a.com|*.b.com;tenantB=c.com 格式的租户 host 白名单
+func ParseTenantHosts(v string) map[string][]string {
+	tenantHosts := map[string][]string{}
+	for _, entry := range splitAndTrim(v, ";") {
+		tenant, hosts, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		tenantHosts[strings.TrimSpace(tenant)] = splitAndTrim(hosts, "|")
+	}
+	return tenantHosts
+}
+
+// Validate 校验 URL 的协议、租户白名单，并解析 DNS 拦截内网地址
+func (p *URLPolicy) Validate(ctx context.Context, tenantID, rawURL string) error {
+	u, err := p.checkStatic(tenantID, rawURL)
+	if err != nil {
+		return err
+	}
+	if p.AllowPrivate {
+		return nil
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return checkIP(ip)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if err := checkIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkStatic 只做不依赖网络的校验：协议、host 白名单、userinfo
+func (p *URLPolicy) checkStatic(tenantID, rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if !containsFold(p.AllowedSchemes, u.Scheme) {
+		return nil, fmt.Errorf("%w: %s", ErrURLScheme, u.Scheme)
+	}
+	if u.Hostname() == "" || u.User != nil {
+		return nil, fmt.Errorf("%w: %s", ErrURLHost, u.Host)
+	}
+	if len(p.TenantHosts) > 0 {
+		hosts, ok := p.TenantHosts[tenantID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrURLTenant, tenantID)
+		}
+		if !hostAllowed(hosts, u.Hostname()) {
+			return nil, fmt.Errorf("%w: %s", ErrURLHost, u.Hostname())
+		}
+	}
+	return u, nil
+}
+
+// HTTPClient 返回一个在拨号阶段再次校验 IP 的客户端，防止 DNS rebinding，
+// 并在每次重定向时重新套用策略
+func (p *URLPolicy) HTTPClient(tenantID string) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if p.AllowPrivate {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("%w: %s", ErrURLPrivateAddr, host)
+			}
+			return checkIP(ip)
+		},
+	}
+	transport := &http.Transport{
+		Proxy:               nil,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   p.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > p.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			_, err := p.checkStatic(tenantID, req.URL.String())
+			return err
+		},
+	}
+}
+
+// Post 在投递时重新校验回调地址，并限制请求体与响应体大小
+func (p *URLPolicy) Post(ctx context.Context, tenantID, rawURL, contentType string, body []byte) (*http.Response, error) {
+	if int64(len(body)) > p.MaxBodyBytes {
+		return nil, ErrBodyTooLarge
+	}
+	if err := p.Validate(ctx, tenantID, rawURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := p.HTTPClient(tenantID).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = limitBody(resp.Body, p.MaxBodyBytes)
+	return resp, nil
+}
+
+// Fetch 校验后 GET 指定 URL，读取的内容不超过 MaxBodyBytes
+func (p *URLPolicy) Fetch(ctx context.Context, tenantID, rawURL string) ([]byte, error) {
+	if err := p.Validate(ctx, tenantID, rawURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.HTTPClient(tenantID).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("fetch %s: status %d", rawURL, resp.StatusCode)
+	}
+	if resp.ContentLength > p.MaxBodyBytes {
+		return nil, ErrBodyTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, p.MaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > p.MaxBodyBytes {
+		return nil, ErrBodyTooLarge
+	}
+	return data, nil
+}
+
+func checkIP(ip net.IP) error {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast() || isSharedAddress(ip) {
+		return fmt.Errorf("%w: %s", ErrURLPrivateAddr, ip)
+	}
+	return nil
+}
+
+// isSharedAddress 判断是否为运营商级 NAT 地址段 100.64.0.0/10
+func isSharedAddress(ip net.IP) bool {
+	ip4 := ip.To4()
+	return ip4 != nil && ip4[0] == 100 && ip4[1]&0xc0 == 64
+}
+
+func hostAllowed(hosts []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range hosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitAndTrim(v, sep string) []string {
+	var out []string
+	for _, part := range strings.Split(v, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+type limitedBody struct {
+	io.Reader
+	io.Closer
+}
+
+func limitBody(body io.ReadCloser, n int64) io.ReadCloser {
+	return limitedBody{Reader: io.LimitReader(body, n), Closer: body}
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/shopspring/decimal"
+)
+
+// FieldError 描述一个字段的校验失败，Pointer 为 RFC 6901 JSON Pointer
+type FieldError struct {
+	Pointer string `json:"pointer"`
+	Reason  string `json:"reason"`
+}
+
+var (
+	validateOnce sync.Once
+	validate     *validator.Validate
+)
+
+// UploadObjectPrefix 是客户端直传作答图片的对象 key 前缀，完整形如 uploads/<租户 ID 的十六进制>/<uuid>
+const UploadObjectPrefix = "uploads/"
+
+var uploadObjectKeyPattern = regexp.MustCompile(`^uploads/[A-Za-z0-9_.-]+/[A-Za-z0-9-]+$`)
+
+// IsUploadObjectKey 判断作答图片是否引用了直传的对象，而不是 URL
+func IsUploadObjectKey(s string) bool {
+	return uploadObjectKeyPattern.MatchString(s)
+}
+
+// Validator 返回共享的 validator 实例，字段名使用 json tag，便于生成 JSON Pointer
+func Validator() *validator.Validate {
+	validateOnce.Do(func() {
+		validate = validator.New(validator.WithRequiredStructEnabled())
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+		// 分数字段使用 decimal，按数值参与 gt/lte 等校验
+		validate.RegisterCustomTypeFunc(func(v reflect.Value) interface{} {
+			f, _ := v.Interface().(decimal.Decimal).Float64()
+			return f
+		}, decimal.Decimal{})
+		// 作答图片既可以是 URL，也可以是直传得到的对象 key
+		_ = validate.RegisterValidation("answer_ref", func(fl validator.FieldLevel) bool {
+			value := fl.Field().String()
+			return IsUploadObjectKey(value) || validate.Var(value, "url") == nil
+		})
+	})
+	return validate
+}
+
+// ValidateStruct 执行结构体上的 validate 标签，返回逐字段的错误列表；校验通过返回 nil
+func ValidateStruct(v interface{}) []FieldError {
+	err := Validator().Struct(v)
+	if err == nil {
+		return nil
+	}
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []FieldError{{Pointer: "", Reason: err.Error()}}
+	}
+	fieldErrors := make([]FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		fieldErrors = append(fieldErrors, FieldError{
+			Pointer: jsonPointer(fe.Namespace()),
+			Reason:  fieldReason(fe),
+		})
+	}
+	return fieldErrors
+}
+
+// jsonPointer 把 SubmitAnswerRequest.student_answers[0].answer_list[1] 转成 /student_answers/0/answer_list/1
+func jsonPointer(namespace string) string {
+	// 第一段是顶层结构体名，不属于请求体
+	_, path, _ := strings.Cut(namespace, ".")
+	var b strings.Builder
+	for _, segment := range strings.Split(path, ".") {
+		name, rest, _ := strings.Cut(segment, "[")
+		b.WriteString("/" + escapePointer(name))
+		for rest != "" {
+			var index string
+			index, rest, _ = strings.Cut(rest, "]")
+			b.WriteString("/" + escapePointer(strings.Trim(index, `"`)))
+			rest = strings.TrimPrefix(rest, "[")
+		}
+	}
+	return b.String()
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func fieldReason(fe validator.FieldError) string {
+	isList := fe.Kind() == reflect.Slice || fe.Kind() == reflect.Array || fe.Kind() == reflect.Map
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "url":
+		return "must be a valid URL"
+	case "answer_ref":
+		return "must be a valid URL or upload object key"
+	case "min":
+		if isList {
+			return fmt.Sprintf("must contain at least %s item(s)", fe.Param())
+		}
+		if _, err := strconv.ParseFloat(fe.Param(), 64); err == nil && fe.Kind() != reflect.String {
+			return "must be at least " + fe.Param()
+		}
+		return fmt.Sprintf("must be at least %s characters long", fe.Param())
+	case "max":
+		if isList {
+			return fmt.Sprintf("must contain at most %s item(s)", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "required_without":
+		return "is required when " + fe.Param() + " is empty"
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be greater than or equal to " + fe.Param()
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	}
+	if fe.Param() != "" {
+		return fmt.Sprintf("failed %s=%s validation", fe.Tag(), fe.Param())
+	}
+	return fmt.Sprintf("failed %s validation", fe.Tag())
+}
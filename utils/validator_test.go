@@ -0,0 +1,61 @@
+package utils
+
+import "testing"
+
+type testAnswer struct {
+	BlockID    string   `json:"block_id" validate:"required"`
+	AnswerList []string `json:"answer_list" validate:"required,min=1,dive,url"`
+}
+
+type testRequest struct {
+	ExamID  string       `json:"exam_id" validate:"required"`
+	Answers []testAnswer `json:"student_answers" validate:"required,min=1,dive"`
+}
+
+func TestValidateStruct(t *testing.T) {
+	req := testRequest{
+		Answers: []testAnswer{
+			{BlockID: "b1", AnswerList: []string{"https://example.com/a.jpg", "not a url"}},
+			{BlockID: "b2", AnswerList: []string{}},
+		},
+	}
+	got := ValidateStruct(&req)
+	want := map[string]string{
+		"/exam_id":                         "is required",
+		"/student_answers/0/answer_list/1": "must be a valid URL",
+		"/student_answers/1/answer_list":   "must contain at least 1 item(s)",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ValidateStruct returned %d errors, want %d: %+v", len(got), len(want), got)
+	}
+	for _, fe := range got {
+		if want[fe.Pointer] != fe.Reason {
+			t.Errorf("unexpected field error %+v", fe)
+		}
+	}
+}
+
+func TestValidateAnswerRef(t *testing.T) {
+	type answer struct {
+		AnswerList []string `json:"answer_list" validate:"dive,answer_ref"`
+	}
+	got := ValidateStruct(&answer{AnswerList: []string{
+		"https://example.com/a.jpg",
+		"uploads/tenant-a/0b6f1c9e-6f7d-4a57-9d83-8e0c7a3b5f21",
+		"not a url",
+		"answers/sha256/abc",
+	}})
+	if len(got) != 2 || got[0].Pointer != "/answer_list/2" || got[1].Pointer != "/answer_list/3" {
+		t.Fatalf("unexpected field errors %+v", got)
+	}
+	if got[0].Reason != "must be a valid URL or upload object key" {
+		t.Errorf("unexpected reason %q", got[0].Reason)
+	}
+}
+
+func TestValidateStructEmptyList(t *testing.T) {
+	got := ValidateStruct(&testRequest{ExamID: "e1", Answers: []testAnswer{}})
+	if len(got) != 1 || got[0].Pointer != "/student_answers" {
+		t.Fatalf("expected empty student_answers to be rejected, got %+v", got)
+	}
+}